@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+// The agent token tests cover how the Authorization header of the LEAF Agent
+// behaves beyond a single valid and invalid request. They need AGENT_TOKEN:
+// the token isn't stored in the leaf_agent database (which holds the agent's
+// task portal), so the suite can't provision tokens of its own. leaf_agent has
+// no token table either, so expired and revoked tokens can't be created and
+// aren't covered here.
+var agentBurst = flag.Int("agent.burst", 50, "number of rapid requests in the agent token rate limit tests")
+
+// agentQueryPath lists unresolved records, including need to know record 505 on the test portal
+const agentQueryPath = `api/form/query?q={"terms":[{"id":"stepID","operator":"!=","match":"resolved","gate":"AND"},{"id":"deleted","operator":"=","match":0,"gate":"AND"}],"joins":[],"sort":{}}`
+
+var agentQuery = RootURL + agentQueryPath
+
+func agentToken(t *testing.T) string {
+	t.Helper()
+
+	token := os.Getenv("AGENT_TOKEN")
+	if token == "" {
+		t.Skip("AGENT_TOKEN is not set")
+	}
+	return token
+}
+
+// agentDo sends a request with token as the Authorization header. jar carries
+// a session when it isn't nil.
+func agentDo(method string, u string, token string, jar http.CookieJar) (int, string, error) {
+	var body io.Reader
+	if method != "GET" {
+		body = strings.NewReader(url.Values{"CSRFToken": {CsrfToken}}.Encode())
+	}
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return 0, "", err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	res, err := newAuthzClient(jar).Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	return res.StatusCode, string(b), err
+}
+
+// agentRecordIDs returns the records in a form/query response
+func agentRecordIDs(t *testing.T, body string) map[int]bool {
+	t.Helper()
+
+	var v any
+	if err := json.Unmarshal([]byte(body), &v); err != nil {
+		t.Fatalf("Could not parse form/query response: %v", truncateString(body, 200))
+	}
+	ids := map[int]bool{}
+	responseRecordIDs(v, ids, true)
+	return ids
+}
+
+// TestAgentToken_OtherPortal sends the token to sites it wasn't issued for.
+// None of them may accept it, so it must get no further than a request
+// without any credentials.
+func TestAgentToken_OtherPortal(t *testing.T) {
+	token := agentToken(t)
+	for _, u := range []string{
+		RootOrgchartURL + "api/group/list",
+		LibraryURL + agentQueryPath,
+		HostURL + "/platform/agent/" + agentQueryPath,
+	} {
+		anonymous, _, err := agentDo("GET", u, "", nil)
+		if err != nil {
+			t.Errorf("%s without credentials: %v", u, err)
+			continue
+		}
+		status, body, err := agentDo("GET", u, token, nil)
+		if err != nil {
+			t.Errorf("%s with the token: %v", u, err)
+			continue
+		}
+
+		if status >= 200 && status < 300 && (anonymous < 200 || anonymous >= 300) {
+			t.Errorf("SECURITY FAILURE: %s accepted the token: status = %v, without credentials = %v: %v", u, status, anonymous, truncateString(body, 200))
+		}
+	}
+}
+
+// TestAgentToken_WritesOnReadOnlyEndpoints sends POST and DELETE to routes
+// that only read. Whatever the status, the database must not change.
+func TestAgentToken_WritesOnReadOnlyEndpoints(t *testing.T) {
+	token := agentToken(t)
+	endpoints := []string{
+		RootURL + "api/form/query",
+		RootURL + "api/form/505/data",
+		RootURL + "api/formWorkflow/8/currentStep",
+		RootURL + "api/workflow/step/1",
+		RootURL + "api/service/members",
+		RootURL + "api/form/indicator/list",
+	}
+
+	before := checksumTestDBs(t)
+	for _, u := range endpoints {
+		for _, method := range []string{"POST", "DELETE"} {
+			status, body, err := agentDo(method, u, token, nil)
+			if err != nil {
+				t.Errorf("%s %s: %v", method, u, err)
+				continue
+			}
+			if status >= 500 {
+				t.Errorf("%s %s: status = %v: %v", method, u, status, truncateString(body, 200))
+			}
+
+			after := checksumTestDBs(t)
+			if changed := changedTables(before, after); len(changed) > 0 {
+				t.Errorf("SECURITY FAILURE: %s %s with the agent token changed the database: %v", method, u, strings.Join(changed, ", "))
+			}
+			before = after
+		}
+	}
+}
+
+// TestAgentToken_WithSessionCookie checks that a session doesn't change what
+// the token can see, and that an invalid token isn't rescued by a session
+func TestAgentToken_WithSessionCookie(t *testing.T) {
+	token := agentToken(t)
+
+	status, tokenOnly, err := agentDo("GET", agentQuery, token, nil)
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("token alone: status = %v, err = %v", status, err)
+	}
+	status, withSession, err := agentDo("GET", agentQuery, token, cookieJar)
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("token with session: status = %v, err = %v", status, err)
+	}
+
+	want := agentRecordIDs(t, tokenOnly)
+	got := agentRecordIDs(t, withSession)
+	for id := range got {
+		if !want[id] {
+			t.Errorf("SECURITY FAILURE: record %v is visible with the token and an admin session, but not with the token alone", id)
+		}
+	}
+	for id := range want {
+		if !got[id] {
+			t.Errorf("record %v is visible with the token alone, but not with the token and an admin session", id)
+		}
+	}
+
+	status, body, err := agentDo("GET", agentQuery, "INVALID TOKEN", cookieJar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != http.StatusUnauthorized {
+		t.Errorf("SECURITY FAILURE: an invalid token with an admin session got status = %v, want = %v: %v", status, http.StatusUnauthorized, truncateString(body, 200))
+	}
+}
+
+// TestAgentToken_WithMasquerade checks that masquerade can only narrow what the token sees
+func TestAgentToken_WithMasquerade(t *testing.T) {
+	token := agentToken(t)
+
+	status, tokenOnly, err := agentDo("GET", agentQuery, token, nil)
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("token alone: status = %v, err = %v", status, err)
+	}
+	status, masqueraded, err := agentDo("GET", agentQuery+"&masquerade=nonAdmin", token, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != http.StatusOK {
+		t.Logf("masquerade with the token: status = %v", status)
+		return
+	}
+
+	want := agentRecordIDs(t, tokenOnly)
+	for id := range agentRecordIDs(t, masqueraded) {
+		if !want[id] {
+			t.Errorf("SECURITY FAILURE: record %v is visible with the token and masquerade=nonAdmin, but not with the token alone", id)
+		}
+	}
+}
+
+// TestAgentToken_RateLimit sends bursts of invalid and valid tokens. Invalid
+// tokens must never succeed, and a 429 must say when to retry. Whether a burst
+// was rate limited at all is only logged.
+func TestAgentToken_RateLimit(t *testing.T) {
+	token := agentToken(t)
+
+	for _, tc := range []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"invalid token", "INVALID TOKEN", http.StatusUnauthorized},
+		{"valid token", token, http.StatusOK},
+	} {
+		statuses := map[int]int{}
+		for i := 0; i < *agentBurst; i++ {
+			req, _ := http.NewRequest("GET", agentQuery, nil)
+			req.Header.Set("Authorization", tc.token)
+			res, err := newAuthzClient(nil).Do(req)
+			if err != nil {
+				t.Errorf("%s: %v", tc.name, err)
+				break
+			}
+			res.Body.Close()
+			statuses[res.StatusCode]++
+
+			switch {
+			case res.StatusCode == http.StatusTooManyRequests:
+				if res.Header.Get("Retry-After") == "" {
+					t.Errorf("%s: 429 without Retry-After", tc.name)
+				}
+			case res.StatusCode != tc.want:
+				t.Errorf("%s: request %v: status = %v, want = %v or %v", tc.name, i+1, res.StatusCode, tc.want, http.StatusTooManyRequests)
+			}
+		}
+
+		if statuses[http.StatusTooManyRequests] == 0 {
+			t.Logf("%s: no rate limit after %v requests: %v", tc.name, *agentBurst, statuses)
+		} else {
+			t.Logf("%s: rate limited: %v", tc.name, statuses)
+		}
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"crypto/cipher"
 	"crypto/rand"
 	"crypto/sha256"
-	"crypto/tls"
 	"encoding/base64"
 	"encoding/hex"
 	"fmt"
@@ -159,14 +158,15 @@ func TestLegitimateRedirectWithQueryParams(t *testing.T) {
 func newUnauthenticatedClient() *http.Client {
 	jar, _ := cookiejar.New(nil)
 	return &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		},
-		Timeout: time.Second * 10,
-		Jar:     jar,
+		Transport: suiteTransport,
+		Timeout:   time.Second * 10,
+		Jar:       jar,
 	}
 }
 
+// authCookieCipherKey is the cipher key of the docker dev environment
+const authCookieCipherKey = "example-key"
+
 // encryptUser mirrors PHP's encryption used to create the REMOTE_USER cookie.
 // PHP decryptUser does:
 //  1. hex2bin(cookie) -> binary containing "base64(ciphertext)::hex(iv)"
@@ -242,7 +242,7 @@ func TestAuthDomain_CheckUserExists_ValidUser(t *testing.T) {
 // decrypts a REMOTE_USER cookie via Security::decryptUser() and authenticates
 // the user via Setting::checkUserExists().
 func TestAuthCookie_DecryptUser_ValidCookie(t *testing.T) {
-	cipherKey := "example-key"
+	cipherKey := authCookieCipherKey
 	encryptedToken, err := encryptUser("tester", cipherKey)
 	if err != nil {
 		t.Fatalf("Failed to encrypt test user token: %v", err)
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The authorization matrix in testdata/authz_matrix.json lists, per endpoint,
+// the outcome each persona should get. A persona missing from a row isn't
+// checked, which is how writes that would succeed are left out. {record} in an
+// endpoint is replaced with a submitted record the test creates for the row,
+// so writes never touch the fixture records other tests depend on.
+var authzMatrixPath = filepath.Join("testdata", "authz_matrix.json")
+
+// authzPersonaNames are the matrix's columns
+var authzPersonaNames = []string{"admin", "nonAdmin", "requestor", "designatedApprover", "groupMember", "anonymous", "agent"}
+
+// authzUsers are fixture users who hold a persona's relationship to the matrix's records
+var authzUsers = map[string]string{
+	"requestor":          "VTRGBKJEANNINE",  // initiated need to know record 505
+	"designatedApprover": "vtrvvtellie",     // designated on record 484, dependency -1
+	"groupMember":        "VTRNYKMILLICENT", // member of Group A, dependency 9 on record 484
+}
+
+type authzRow struct {
+	Name     string                  `json:"name"`
+	Method   string                  `json:"method"`
+	Endpoint string                  `json:"endpoint"`
+	Body     map[string]string       `json:"body,omitempty"`
+	Expect   map[string]authzOutcome `json:"expect"`
+}
+
+// authzOutcome is a cell. Status 0 accepts any status. Visible and hidden are
+// recordIDs that must or must not appear, and empty requires an empty (or a
+// non-empty) response. Response and notResponse are a body the response must
+// or must not be.
+type authzOutcome struct {
+	Status      int    `json:"status,omitempty"`
+	Visible     []int  `json:"visible,omitempty"`
+	Hidden      []int  `json:"hidden,omitempty"`
+	Empty       *bool  `json:"empty,omitempty"`
+	Response    string `json:"response,omitempty"`
+	NotResponse string `json:"notResponse,omitempty"`
+}
+
+// authzPersona sends requests as one persona. unavailable explains why it can't.
+type authzPersona struct {
+	client      *http.Client
+	csrfToken   string
+	masquerade  bool
+	header      http.Header
+	unavailable string
+}
+
+func newAuthzClient(jar http.CookieJar) *http.Client {
+	return &http.Client{
+		Transport: suiteTransport,
+		Timeout:   time.Second * 10,
+		Jar:       jar,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// loginAs starts a session as userID through auth_cookie, the way a browser with a REMOTE_USER cookie would
+func loginAs(userID string) authzPersona {
+	token, err := encryptUser(userID, authCookieCipherKey)
+	if err != nil {
+		return authzPersona{unavailable: err.Error()}
+	}
+
+	jar, _ := cookiejar.New(nil)
+	cookieURL, _ := url.Parse(RootURL)
+	jar.SetCookies(cookieURL, []*http.Cookie{{Name: "REMOTE_USER", Value: token, Path: "/"}})
+
+	p := authzPersona{client: newAuthzClient(jar)}
+	if _, err := p.get(RootURL + "auth_cookie/"); err != nil {
+		return authzPersona{unavailable: "auth_cookie: " + err.Error()}
+	}
+
+	body, err := p.get(RootURL)
+	if err != nil || !strings.Contains(body, "var CSRFToken") {
+		return authzPersona{unavailable: "could not log in as " + userID}
+	}
+	p.csrfToken = readCSRFToken(body)
+	return p
+}
+
+func (p authzPersona) get(u string) (string, error) {
+	res, err := p.client.Get(u)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	return string(b), err
+}
+
+func newAuthzPersonas() map[string]authzPersona {
+	personas := map[string]authzPersona{
+		"admin":    {client: newAuthzClient(cookieJar), csrfToken: CsrfToken},
+		"nonAdmin": {client: newAuthzClient(cookieJar), csrfToken: CsrfToken, masquerade: true},
+	}
+	for persona, userID := range authzUsers {
+		personas[persona] = loginAs(userID)
+	}
+
+	// No session and no REMOTE_USER cookie
+	jar, _ := cookiejar.New(nil)
+	personas["anonymous"] = authzPersona{client: newAuthzClient(jar)}
+
+	if token := os.Getenv("AGENT_TOKEN"); token != "" {
+		personas["agent"] = authzPersona{client: newAuthzClient(nil), header: http.Header{"Authorization": {token}}}
+	} else {
+		personas["agent"] = authzPersona{unavailable: "AGENT_TOKEN is not set"}
+	}
+	return personas
+}
+
+func (p authzPersona) do(row authzRow) (int, string, error) {
+	target := RootURL + row.Endpoint
+	if p.masquerade {
+		sep := "?"
+		if strings.Contains(target, "?") {
+			sep = "&"
+		}
+		target += sep + "masquerade=nonAdmin"
+	}
+
+	var body io.Reader
+	if row.Method != "GET" {
+		form := url.Values{}
+		for k, v := range row.Body {
+			form.Set(k, v)
+		}
+		form.Set("CSRFToken", p.csrfToken)
+		body = strings.NewReader(form.Encode())
+	}
+
+	req, err := http.NewRequest(row.Method, target, body)
+	if err != nil {
+		return 0, "", err
+	}
+	for name, values := range p.header {
+		req.Header[name] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	return res.StatusCode, string(b), err
+}
+
+// responseRecordIDs finds recordIDs in a response: the keys of a form/query
+// result, and any recordID fields
+func responseRecordIDs(v any, ids map[int]bool, topLevel bool) {
+	switch val := v.(type) {
+	case map[string]any:
+		for k, child := range val {
+			if id, err := strconv.Atoi(k); err == nil && topLevel {
+				ids[id] = true
+			}
+			if k == "recordID" {
+				if id, err := strconv.Atoi(fmt.Sprint(child)); err == nil {
+					ids[id] = true
+				}
+			}
+			responseRecordIDs(child, ids, false)
+		}
+	case []any:
+		for _, child := range val {
+			responseRecordIDs(child, ids, false)
+		}
+	}
+}
+
+func isEmptyResponse(body string) bool {
+	var v any
+	if err := json.Unmarshal([]byte(body), &v); err != nil {
+		return strings.TrimSpace(body) == ""
+	}
+	switch val := v.(type) {
+	case nil:
+		return true
+	case map[string]any:
+		return len(val) == 0
+	case []any:
+		return len(val) == 0
+	case string:
+		return val == ""
+	}
+	return false
+}
+
+// check returns the ways a response doesn't match the outcome
+func (o authzOutcome) check(status int, body string) []string {
+	var problems []string
+	if o.Status != 0 && status != o.Status {
+		problems = append(problems, fmt.Sprintf("status = %v, want = %v", status, o.Status))
+	}
+
+	ids := map[int]bool{}
+	var v any
+	if json.Unmarshal([]byte(body), &v) == nil {
+		responseRecordIDs(v, ids, true)
+	}
+	for _, id := range o.Visible {
+		if !ids[id] {
+			problems = append(problems, fmt.Sprintf("record %v is not visible", id))
+		}
+	}
+	for _, id := range o.Hidden {
+		if ids[id] {
+			problems = append(problems, fmt.Sprintf("record %v is visible", id))
+		}
+	}
+
+	if o.Empty != nil && isEmptyResponse(body) != *o.Empty {
+		if *o.Empty {
+			problems = append(problems, "response has data, want none")
+		} else {
+			problems = append(problems, "response is empty, want data")
+		}
+	}
+
+	if o.Response != "" && body != o.Response {
+		problems = append(problems, fmt.Sprintf("response = %v, want = %v", truncateString(body, 200), o.Response))
+	}
+	if o.NotResponse != "" && body == o.NotResponse {
+		problems = append(problems, fmt.Sprintf("response = %v", o.NotResponse))
+	}
+	return problems
+}
+
+// newAuthzRecord creates a record as the admin and submits it
+func newAuthzRecord(t *testing.T) string {
+	t.Helper()
+
+	postData := url.Values{}
+	postData.Set("CSRFToken", CsrfToken)
+	postData.Set("numform_5ea07", "1")
+	postData.Set("title", "TestAuthorizationMatrix")
+	postData.Set("8", "1")
+	postData.Set("9", "112")
+
+	res, err := client.PostForm(RootURL+`api/form/new`, postData)
+	if err != nil {
+		t.Fatalf("Could not create a record: %v", err)
+	}
+	b, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	var recordID string
+	if err := decodeJSON(res.Request.URL.String(), b, &recordID); err != nil {
+		t.Fatalf("Could not create a record: %v", truncateString(string(b), 200))
+	}
+	if _, err := strconv.Atoi(recordID); err != nil {
+		t.Fatalf("Could not create a record: %v", recordID)
+	}
+
+	postData = url.Values{}
+	postData.Set("CSRFToken", CsrfToken)
+	res, err = client.PostForm(RootURL+`api/form/`+recordID+`/submit`, postData)
+	if err != nil {
+		t.Fatalf("Could not submit record %v: %v", recordID, err)
+	}
+	res.Body.Close()
+	return recordID
+}
+
+// TestAuthorizationMatrix runs every cell of testdata/authz_matrix.json and logs a grid of the results
+func TestAuthorizationMatrix(t *testing.T) {
+	b, err := os.ReadFile(authzMatrixPath)
+	if err != nil {
+		t.Fatalf("Could not read %s: %v", authzMatrixPath, err)
+	}
+	var rows []authzRow
+	if err := json.Unmarshal(b, &rows); err != nil {
+		t.Fatalf("Could not parse %s: %v", authzMatrixPath, err)
+	}
+
+	personas := newAuthzPersonas()
+	for _, name := range authzPersonaNames {
+		if reason := personas[name].unavailable; reason != "" {
+			t.Logf("Persona %s is skipped: %s", name, reason)
+		}
+	}
+
+	grid := make([][]string, len(rows))
+	for i, row := range rows {
+		if strings.Contains(row.Endpoint, "{record}") {
+			row.Endpoint = strings.ReplaceAll(row.Endpoint, "{record}", newAuthzRecord(t))
+		}
+		for persona := range row.Expect {
+			if _, exists := personas[persona]; !exists {
+				t.Errorf("%s: unknown persona %q in %s", row.Name, persona, authzMatrixPath)
+			}
+		}
+
+		grid[i] = make([]string, len(authzPersonaNames))
+		for j, name := range authzPersonaNames {
+			want, exists := row.Expect[name]
+			p := personas[name]
+			switch {
+			case !exists:
+				grid[i][j] = "-"
+				continue
+			case p.unavailable != "":
+				grid[i][j] = "skip"
+				continue
+			}
+
+			status, body, err := p.do(row)
+			if err != nil {
+				grid[i][j] = "ERROR"
+				t.Errorf("%s as %s: %v", row.Name, name, err)
+				continue
+			}
+			if problems := want.check(status, body); len(problems) > 0 {
+				grid[i][j] = "FAIL"
+				t.Errorf("%s as %s: %s: %v", row.Name, name, strings.Join(problems, ", "), truncateString(body, 200))
+				continue
+			}
+			grid[i][j] = "ok"
+		}
+	}
+
+	t.Log("\n" + authzGrid(rows, grid))
+}
+
+// authzGrid lays out the results with endpoints as rows and personas as columns
+func authzGrid(rows []authzRow, grid [][]string) string {
+	nameWidth := len("endpoint")
+	for _, row := range rows {
+		nameWidth = max(nameWidth, len(row.Name))
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%-*s", nameWidth, "endpoint")
+	for _, name := range authzPersonaNames {
+		fmt.Fprintf(&sb, "  %s", name)
+	}
+	sb.WriteString("\n")
+
+	failed := map[string]int{}
+	for i, row := range rows {
+		fmt.Fprintf(&sb, "%-*s", nameWidth, row.Name)
+		for j, name := range authzPersonaNames {
+			fmt.Fprintf(&sb, "  %-*s", len(name), grid[i][j])
+			if grid[i][j] == "FAIL" || grid[i][j] == "ERROR" {
+				failed[name]++
+			}
+		}
+		sb.WriteString("\n")
+	}
+
+	names := make([]string, 0, len(failed))
+	for name := range failed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&sb, "%s: %d mismatch(es)\n", name, failed[name])
+	}
+	return sb.String()
+}
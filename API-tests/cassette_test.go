@@ -0,0 +1,642 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Cassettes let the suite run without the docker environment. In record mode
+// each test's HTTP exchanges and SQL results are saved to
+// testdata/cassettes/<test>.json. Replay mode serves them back instead of
+// contacting LEAF or MySQL, and verify mode runs against the live system and
+// reports the cassettes whose recorded responses no longer match.
+//
+//	go test -cassette=record
+//	go test -cassette=replay
+//	go test -cassette=verify
+var cassetteMode = flag.String("cassette", "", "record, replay or verify HTTP and SQL cassettes")
+var cassetteDir = flag.String("cassette.dir", "testdata/cassettes", "directory holding the cassettes")
+
+// dbDriver is the database/sql driver used by getDB. It's "cassette" while recording or replaying.
+var dbDriver = "mysql"
+
+func init() {
+	sql.Register("cassette", cassetteDriver{})
+}
+
+type cassette struct {
+	Test string              `json:"test"`
+	HTTP []*cassetteExchange `json:"http"`
+	SQL  []*cassetteQuery    `json:"sql,omitempty"`
+}
+
+// cassetteExchange is one recorded HTTP request. URLs are stored without
+// HostURL and CSRF tokens are redacted, so cassettes don't depend on the session.
+type cassetteExchange struct {
+	Method       string      `json:"method"`
+	URL          string      `json:"url"`
+	RequestBody  string      `json:"requestBody,omitempty"`
+	Status       int         `json:"status"`
+	Header       http.Header `json:"header,omitempty"`
+	ResponseBody string      `json:"responseBody"`
+	used         bool
+}
+
+type cassetteQuery struct {
+	Query        string            `json:"query"`
+	Args         []cassetteValue   `json:"args,omitempty"`
+	Columns      []string          `json:"columns,omitempty"`
+	Rows         [][]cassetteValue `json:"rows,omitempty"`
+	RowsAffected int64             `json:"rowsAffected,omitempty"`
+	LastInsertID int64             `json:"lastInsertId,omitempty"`
+	Err          string            `json:"err,omitempty"`
+	used         bool
+}
+
+// cassetteValue keeps a driver.Value's type through JSON
+type cassetteValue struct {
+	Type  string `json:"t"`
+	Value string `json:"v,omitempty"`
+}
+
+var activeCassette *cassette
+var mxCassette sync.Mutex
+
+// cassetteIssues lists, per cassette, requests that were missing or stale
+var cassetteIssues = map[string][]string{}
+
+// cassetteHeaderSkip are response headers that differ on every request
+var cassetteHeaderSkip = map[string]bool{
+	"Date":       true,
+	"Set-Cookie": true,
+}
+
+// setupCassettes validates -cassette and routes the clients and getDB through the cassettes
+func setupCassettes() {
+	switch *cassetteMode {
+	case "":
+		return
+	case "record":
+		dbDriver = "cassette"
+		observeTraffic(recordCassette)
+	case "replay":
+		dbDriver = "cassette"
+		baseTransport = cassetteTransport{}
+	case "verify":
+		observeTraffic(verifyCassette)
+	default:
+		log.Fatal("-cassette must be record, replay or verify")
+	}
+
+	if *employeeCount > 0 || *recordCount > 0 {
+		log.Fatal("-cassette can't be combined with -employees or -records")
+	}
+}
+
+func cassettePath(name string) string {
+	return filepath.Join(*cassetteDir, strings.ReplaceAll(name, "/", "_")+".json")
+}
+
+// startCassette makes name the cassette for the following requests and queries
+func startCassette(name string) {
+	if *cassetteMode == "" {
+		return
+	}
+
+	c := &cassette{Test: name}
+	if *cassetteMode != "record" {
+		b, err := os.ReadFile(cassettePath(name))
+		if err == nil {
+			err = json.Unmarshal(b, c)
+		}
+		if err != nil {
+			addCassetteIssue(name, fmt.Sprintf("can't load cassette: %v", err))
+		}
+	}
+
+	mxCassette.Lock()
+	activeCassette = c
+	mxCassette.Unlock()
+}
+
+// finishCassette saves the recording, or notes recorded requests that weren't made again
+func finishCassette() {
+	mxCassette.Lock()
+	c := activeCassette
+	activeCassette = nil
+	mxCassette.Unlock()
+
+	if c == nil {
+		return
+	}
+
+	switch *cassetteMode {
+	case "record":
+		b, err := json.MarshalIndent(c, "", "  ")
+		if err == nil {
+			err = os.MkdirAll(*cassetteDir, 0775)
+		}
+		if err == nil {
+			err = os.WriteFile(cassettePath(c.Test), append(b, '\n'), 0664)
+		}
+		if err != nil {
+			log.Println("Could not write cassette: ", err)
+		}
+	case "verify":
+		for _, ex := range c.HTTP {
+			if !ex.used {
+				addCassetteIssue(c.Test, fmt.Sprintf("%s %s: recorded but no longer requested", ex.Method, ex.URL))
+			}
+		}
+	}
+}
+
+func addCassetteIssue(name string, issue string) {
+	mxCassette.Lock()
+	defer mxCassette.Unlock()
+	cassetteIssues[name] = append(cassetteIssues[name], issue)
+}
+
+// cassetteReport summarizes missing and stale cassettes after the run
+func cassetteReport() string {
+	mxCassette.Lock()
+	defer mxCassette.Unlock()
+
+	if len(cassetteIssues) == 0 {
+		return fmt.Sprintf("Cassettes (%s): no issues found\n", *cassetteMode)
+	}
+
+	names := make([]string, 0, len(cassetteIssues))
+	for name := range cassetteIssues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Cassettes (%s): %d cassette(s) need to be re-recorded with -cassette=record\n", *cassetteMode, len(names))
+	for _, name := range names {
+		fmt.Fprintf(&sb, "\n%s\n", name)
+		for _, issue := range cassetteIssues[name] {
+			fmt.Fprintf(&sb, "    %s\n", issue)
+		}
+	}
+	return sb.String()
+}
+
+// match finds the first unused exchange for a request, preferring one with the same body
+func (c *cassette) match(method string, url string, body string) *cassetteExchange {
+	var sameURL *cassetteExchange
+	for _, ex := range c.HTTP {
+		if ex.used || ex.Method != method || ex.URL != url {
+			continue
+		}
+		if ex.RequestBody == body {
+			return ex
+		}
+		if sameURL == nil {
+			sameURL = ex
+		}
+	}
+	return sameURL
+}
+
+func cassetteRequest(req *http.Request, body []byte) (method string, url string, reqBody string) {
+	return req.Method, redactCSRFToken(strings.TrimPrefix(req.URL.String(), HostURL)), redactCSRFToken(string(body))
+}
+
+// recordCassette is a trafficObserver
+func recordCassette(ex *exchange) {
+	if ex.Response == nil {
+		return
+	}
+
+	method, url, body := cassetteRequest(ex.Request, ex.RequestBody)
+	header := http.Header{}
+	for name, values := range ex.Response.Header {
+		if !cassetteHeaderSkip[name] {
+			header[name] = values
+		}
+	}
+
+	mxCassette.Lock()
+	defer mxCassette.Unlock()
+	if activeCassette != nil {
+		activeCassette.HTTP = append(activeCassette.HTTP, &cassetteExchange{
+			Method:       method,
+			URL:          url,
+			RequestBody:  body,
+			Status:       ex.Response.StatusCode,
+			Header:       header,
+			ResponseBody: string(ex.ResponseBody),
+		})
+	}
+}
+
+// verifyCassette is a trafficObserver. It compares status codes, and bodies
+// too when both are JSON, after masking values that change between runs.
+func verifyCassette(ex *exchange) {
+	if ex.Response == nil {
+		return
+	}
+
+	method, url, body := cassetteRequest(ex.Request, ex.RequestBody)
+
+	mxCassette.Lock()
+	c := activeCassette
+	var recorded *cassetteExchange
+	if c != nil {
+		recorded = c.match(method, url, body)
+		if recorded != nil {
+			recorded.used = true
+		}
+	}
+	mxCassette.Unlock()
+
+	if c == nil {
+		return
+	}
+	if recorded == nil {
+		addCassetteIssue(c.Test, fmt.Sprintf("%s %s: not in the cassette", method, url))
+		return
+	}
+	if recorded.Status != ex.Response.StatusCode {
+		addCassetteIssue(c.Test, fmt.Sprintf("%s %s: status %d, recorded %d", method, url, ex.Response.StatusCode, recorded.Status))
+		return
+	}
+
+	got, errGot := normalizeGolden(string(ex.ResponseBody))
+	want, errWant := normalizeGolden(recorded.ResponseBody)
+	if errGot == nil && errWant == nil && got != want {
+		addCassetteIssue(c.Test, fmt.Sprintf("%s %s: response body changed", method, url))
+	}
+}
+
+// cassetteTransport answers requests from the active cassette
+type cassetteTransport struct{}
+
+func (cassetteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		body, _ = io.ReadAll(req.Body)
+		req.Body.Close()
+	}
+	method, url, reqBody := cassetteRequest(req, body)
+
+	mxCassette.Lock()
+	c := activeCassette
+	var recorded *cassetteExchange
+	if c != nil {
+		recorded = c.match(method, url, reqBody)
+		if recorded != nil {
+			recorded.used = true
+		}
+	}
+	mxCassette.Unlock()
+
+	if recorded == nil {
+		name := "(no cassette)"
+		if c != nil {
+			name = c.Test
+			addCassetteIssue(name, fmt.Sprintf("%s %s: not in the cassette", method, url))
+		}
+		msg := fmt.Sprintf("cassette %s has no response for %s %s", name, method, url)
+		return &http.Response{
+			Status:        "501 Not Implemented",
+			StatusCode:    http.StatusNotImplemented,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{"Content-Type": {"text/plain"}},
+			Body:          io.NopCloser(strings.NewReader(msg)),
+			ContentLength: int64(len(msg)),
+			Request:       req,
+		}, nil
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.Status, http.StatusText(recorded.Status)),
+		StatusCode:    recorded.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        recorded.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader([]byte(recorded.ResponseBody))),
+		ContentLength: int64(len(recorded.ResponseBody)),
+		Request:       req,
+	}, nil
+}
+
+// cassetteDriver wraps the MySQL driver while recording, and serves recorded
+// results without a database while replaying
+type cassetteDriver struct{}
+
+func (cassetteDriver) Open(dsn string) (driver.Conn, error) {
+	if *cassetteMode == "replay" {
+		return &cassetteConn{}, nil
+	}
+
+	real, err := mysql.MySQLDriver{}.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &cassetteConn{real: real}, nil
+}
+
+// cassetteConn records through real, or replays when real is nil
+type cassetteConn struct {
+	real driver.Conn
+}
+
+func (c *cassetteConn) Prepare(query string) (driver.Stmt, error) {
+	if c.real == nil {
+		return &cassetteStmt{conn: c, query: query}, nil
+	}
+	stmt, err := c.real.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	return &cassetteStmt{conn: c, query: query, real: stmt}, nil
+}
+
+func (c *cassetteConn) Close() error {
+	if c.real == nil {
+		return nil
+	}
+	return c.real.Close()
+}
+
+func (c *cassetteConn) Begin() (driver.Tx, error) {
+	if c.real == nil {
+		return cassetteTx{}, nil
+	}
+	return c.real.Begin()
+}
+
+func (c *cassetteConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if c.real == nil {
+		return replayExec(query, args)
+	}
+	res, err := c.real.(driver.ExecerContext).ExecContext(ctx, query, args)
+	if err == driver.ErrSkip {
+		return nil, err
+	}
+	recordExec(query, args, res, err)
+	return res, err
+}
+
+func (c *cassetteConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if c.real == nil {
+		return replayQuery(query, args)
+	}
+	rows, err := c.real.(driver.QueryerContext).QueryContext(ctx, query, args)
+	if err == driver.ErrSkip {
+		return nil, err
+	}
+	return recordQuery(query, args, rows, err)
+}
+
+type cassetteStmt struct {
+	conn  *cassetteConn
+	query string
+	real  driver.Stmt
+}
+
+func (s *cassetteStmt) Close() error {
+	if s.real == nil {
+		return nil
+	}
+	return s.real.Close()
+}
+
+func (s *cassetteStmt) NumInput() int {
+	if s.real == nil {
+		return -1
+	}
+	return s.real.NumInput()
+}
+
+func (s *cassetteStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if s.real == nil {
+		return replayExec(s.query, namedValues(args))
+	}
+	res, err := s.real.Exec(args)
+	recordExec(s.query, namedValues(args), res, err)
+	return res, err
+}
+
+func (s *cassetteStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if s.real == nil {
+		return replayQuery(s.query, namedValues(args))
+	}
+	rows, err := s.real.Query(args)
+	return recordQuery(s.query, namedValues(args), rows, err)
+}
+
+type cassetteTx struct{}
+
+func (cassetteTx) Commit() error   { return nil }
+func (cassetteTx) Rollback() error { return nil }
+
+type cassetteResult struct {
+	lastInsertID int64
+	rowsAffected int64
+}
+
+func (r cassetteResult) LastInsertId() (int64, error) { return r.lastInsertID, nil }
+func (r cassetteResult) RowsAffected() (int64, error) { return r.rowsAffected, nil }
+
+// cassetteRows returns rows held in memory
+type cassetteRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *cassetteRows) Columns() []string { return r.columns }
+func (r *cassetteRows) Close() error      { return nil }
+
+func (r *cassetteRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func namedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return named
+}
+
+func recordExec(query string, args []driver.NamedValue, res driver.Result, err error) {
+	q := &cassetteQuery{Query: query, Args: encodeArgs(args)}
+	if err != nil {
+		q.Err = err.Error()
+	} else {
+		q.LastInsertID, _ = res.LastInsertId()
+		q.RowsAffected, _ = res.RowsAffected()
+	}
+	appendCassetteQuery(q)
+}
+
+// recordQuery reads all rows so they can be saved, and returns them from memory
+func recordQuery(query string, args []driver.NamedValue, rows driver.Rows, err error) (driver.Rows, error) {
+	q := &cassetteQuery{Query: query, Args: encodeArgs(args)}
+	if err != nil {
+		q.Err = err.Error()
+		appendCassetteQuery(q)
+		return nil, err
+	}
+	defer rows.Close()
+
+	mem := &cassetteRows{columns: rows.Columns()}
+	for {
+		dest := make([]driver.Value, len(mem.columns))
+		if err := rows.Next(dest); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		row := make([]cassetteValue, len(dest))
+		for i, v := range dest {
+			// The driver reuses its buffers between rows
+			if b, ok := v.([]byte); ok {
+				dest[i] = bytes.Clone(b)
+			}
+			row[i] = encodeValue(dest[i])
+		}
+		mem.rows = append(mem.rows, dest)
+		q.Rows = append(q.Rows, row)
+	}
+	q.Columns = mem.columns
+
+	appendCassetteQuery(q)
+	return mem, nil
+}
+
+func appendCassetteQuery(q *cassetteQuery) {
+	mxCassette.Lock()
+	defer mxCassette.Unlock()
+	if activeCassette != nil {
+		activeCassette.SQL = append(activeCassette.SQL, q)
+	}
+}
+
+// replayedQuery finds the first unused recording of a query with the same arguments
+func replayedQuery(query string, args []driver.NamedValue) (*cassetteQuery, error) {
+	want := encodeArgs(args)
+
+	mxCassette.Lock()
+	defer mxCassette.Unlock()
+
+	if activeCassette == nil {
+		return nil, fmt.Errorf("cassette: no cassette for query %q", truncateString(query, 100))
+	}
+	for _, q := range activeCassette.SQL {
+		if !q.used && q.Query == query && fmt.Sprint(q.Args) == fmt.Sprint(want) {
+			q.used = true
+			if q.Err != "" {
+				return nil, fmt.Errorf("%s", q.Err)
+			}
+			return q, nil
+		}
+	}
+
+	issue := fmt.Sprintf("query not in the cassette: %s", truncateString(query, 100))
+	cassetteIssues[activeCassette.Test] = append(cassetteIssues[activeCassette.Test], issue)
+	return nil, fmt.Errorf("cassette %s: %s", activeCassette.Test, issue)
+}
+
+func replayExec(query string, args []driver.NamedValue) (driver.Result, error) {
+	q, err := replayedQuery(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return cassetteResult{lastInsertID: q.LastInsertID, rowsAffected: q.RowsAffected}, nil
+}
+
+func replayQuery(query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, err := replayedQuery(query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	mem := &cassetteRows{columns: q.Columns}
+	for _, row := range q.Rows {
+		values := make([]driver.Value, len(row))
+		for i, v := range row {
+			values[i] = decodeValue(v)
+		}
+		mem.rows = append(mem.rows, values)
+	}
+	return mem, nil
+}
+
+func encodeArgs(args []driver.NamedValue) []cassetteValue {
+	values := make([]cassetteValue, len(args))
+	for i, arg := range args {
+		values[i] = encodeValue(arg.Value)
+	}
+	return values
+}
+
+func encodeValue(v driver.Value) cassetteValue {
+	switch val := v.(type) {
+	case nil:
+		return cassetteValue{Type: "null"}
+	case []byte:
+		return cassetteValue{Type: "bytes", Value: string(val)}
+	case string:
+		return cassetteValue{Type: "string", Value: val}
+	case int64:
+		return cassetteValue{Type: "int", Value: strconv.FormatInt(val, 10)}
+	case float64:
+		return cassetteValue{Type: "float", Value: strconv.FormatFloat(val, 'g', -1, 64)}
+	case bool:
+		return cassetteValue{Type: "bool", Value: strconv.FormatBool(val)}
+	case time.Time:
+		return cassetteValue{Type: "time", Value: val.Format(time.RFC3339Nano)}
+	}
+	return cassetteValue{Type: "string", Value: fmt.Sprint(v)}
+}
+
+func decodeValue(v cassetteValue) driver.Value {
+	switch v.Type {
+	case "null":
+		return nil
+	case "bytes":
+		return []byte(v.Value)
+	case "int":
+		n, _ := strconv.ParseInt(v.Value, 10, 64)
+		return n
+	case "float":
+		f, _ := strconv.ParseFloat(v.Value, 64)
+		return f
+	case "bool":
+		return v.Value == "true"
+	case "time":
+		t, _ := time.Parse(time.RFC3339Nano, v.Value)
+		return t
+	}
+	return v.Value
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// normalizedTimestamp replaces values in columns maintained by
+// ON UPDATE CURRENT_TIMESTAMP, which change whenever a test touches a row.
+const normalizedTimestamp = "2000-01-01 00:00:00"
+
+const dumpHeader = `SET NAMES utf8;
+SET time_zone = '+00:00';
+SET foreign_key_checks = 0;
+SET sql_mode = 'NO_AUTO_VALUE_ON_ZERO';
+
+SET NAMES utf8mb4;
+
+`
+
+var autoIncrementOption = regexp.MustCompile(` AUTO_INCREMENT=\d+`)
+
+var numericTypes = map[string]bool{
+	"tinyint":   true,
+	"smallint":  true,
+	"mediumint": true,
+	"int":       true,
+	"bigint":    true,
+	"decimal":   true,
+	"float":     true,
+	"double":    true,
+	"year":      true,
+}
+
+type column struct {
+	Name     string
+	DataType string
+	Extra    string
+}
+
+// numeric reports whether values of the column are written without quotes
+func (c column) numeric() bool {
+	return numericTypes[c.DataType]
+}
+
+// generated reports whether MySQL computes the column, in which case it can't be inserted
+func (c column) generated() bool {
+	return strings.Contains(c.Extra, "GENERATED") && !strings.Contains(c.Extra, "DEFAULT_GENERATED")
+}
+
+// autoUpdated reports whether MySQL rewrites the column every time the row changes
+func (c column) autoUpdated() bool {
+	return strings.Contains(strings.ToLower(c.Extra), "on update current_timestamp")
+}
+
+type dumper struct {
+	db     *sql.DB
+	schema string
+	scrub  bool
+}
+
+// dumpDatabase renders every table in the schema as SQL suitable for database/*.sql
+func (d *dumper) dumpDatabase() (string, error) {
+	tables, err := d.tables()
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	sb.WriteString(dumpHeader)
+	for _, table := range tables {
+		if err := d.dumpTable(&sb, table); err != nil {
+			return "", fmt.Errorf("table %s: %w", table, err)
+		}
+	}
+
+	return sb.String(), nil
+}
+
+func (d *dumper) tables() ([]string, error) {
+	rows, err := d.db.Query(`SELECT TABLE_NAME FROM information_schema.TABLES
+								WHERE TABLE_SCHEMA = ? AND TABLE_TYPE = 'BASE TABLE'`, d.schema)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		tables = append(tables, name)
+	}
+	sort.Strings(tables)
+
+	return tables, rows.Err()
+}
+
+func (d *dumper) dumpTable(sb *strings.Builder, table string) error {
+	var name, createSQL string
+	err := d.db.QueryRow("SHOW CREATE TABLE "+quoteIdentifier(d.schema)+"."+quoteIdentifier(table)).
+		Scan(&name, &createSQL)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(sb, "DROP TABLE IF EXISTS %s;\n", quoteIdentifier(table))
+	sb.WriteString(stripAutoIncrement(createSQL) + ";\n\n")
+
+	if volatileTables[table] {
+		sb.WriteString("\n")
+		return nil
+	}
+
+	columns, err := d.columns(table)
+	if err != nil {
+		return err
+	}
+
+	orderBy, err := d.sortColumns(table, columns)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, len(columns))
+	for i, c := range columns {
+		names[i] = quoteIdentifier(c.Name)
+	}
+	columnList := strings.Join(names, ", ")
+
+	for i, c := range orderBy {
+		orderBy[i] = quoteIdentifier(c)
+	}
+
+	rows, err := d.db.Query("SELECT " + columnList + " FROM " + quoteIdentifier(d.schema) + "." + quoteIdentifier(table) +
+		" ORDER BY " + strings.Join(orderBy, ", "))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	values := make([]sql.RawBytes, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+
+	formatted := make([]string, len(columns))
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		for i, c := range columns {
+			formatted[i] = d.formatValue(c, values[i])
+		}
+		fmt.Fprintf(sb, "INSERT INTO %s (%s) VALUES (%s);\n",
+			quoteIdentifier(table), columnList, strings.Join(formatted, ",\t"))
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	sb.WriteString("\n")
+
+	return nil
+}
+
+// columns returns the insertable columns of a table in their defined order
+func (d *dumper) columns(table string) ([]column, error) {
+	rows, err := d.db.Query(`SELECT COLUMN_NAME, DATA_TYPE, EXTRA FROM information_schema.COLUMNS
+								WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?
+								ORDER BY ORDINAL_POSITION`, d.schema, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []column
+	for rows.Next() {
+		var c column
+		if err := rows.Scan(&c.Name, &c.DataType, &c.Extra); err != nil {
+			return nil, err
+		}
+		if !c.generated() {
+			columns = append(columns, c)
+		}
+	}
+
+	return columns, rows.Err()
+}
+
+// sortColumns picks a stable row order: the primary key, otherwise the first
+// unique key by name, otherwise every column.
+func (d *dumper) sortColumns(table string, columns []column) ([]string, error) {
+	rows, err := d.db.Query(`SELECT INDEX_NAME, COLUMN_NAME FROM information_schema.STATISTICS
+								WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? AND NON_UNIQUE = 0
+								ORDER BY INDEX_NAME = 'PRIMARY' DESC, INDEX_NAME, SEQ_IN_INDEX`, d.schema, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keyName string
+	var key []string
+	for rows.Next() {
+		var index, col string
+		if err := rows.Scan(&index, &col); err != nil {
+			return nil, err
+		}
+		if keyName == "" {
+			keyName = index
+		}
+		if index != keyName {
+			break
+		}
+		key = append(key, col)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(key) == 0 {
+		for _, c := range columns {
+			key = append(key, c.Name)
+		}
+	}
+
+	return key, nil
+}
+
+func (d *dumper) formatValue(c column, value sql.RawBytes) string {
+	if value == nil {
+		return "NULL"
+	}
+	if c.autoUpdated() {
+		return quoteString(normalizedTimestamp)
+	}
+	if c.numeric() {
+		return string(value)
+	}
+
+	s := string(value)
+	if d.scrub {
+		s = scrubPII(s)
+	}
+	return quoteString(s)
+}
+
+// stripAutoIncrement removes the table's AUTO_INCREMENT counter, which depends
+// on rows that may have been inserted and deleted since the fixture was loaded
+func stripAutoIncrement(createSQL string) string {
+	return autoIncrementOption.ReplaceAllString(createSQL, "")
+}
+
+func quoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// quoteString escapes a value the same way as the existing fixture files
+func quoteString(s string) string {
+	var sb strings.Builder
+	sb.Grow(len(s) + 2)
+	sb.WriteByte('\'')
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\'':
+			sb.WriteString(`\'`)
+		case '"':
+			sb.WriteString(`\"`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case 0:
+			sb.WriteString(`\0`)
+		case 0x1a:
+			sb.WriteString(`\Z`)
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+	sb.WriteByte('\'')
+	return sb.String()
+}
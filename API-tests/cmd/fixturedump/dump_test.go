@@ -0,0 +1,61 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestQuoteString_MatchesFixtureEscaping(t *testing.T) {
+	got := quoteString("O'Tester said \"hi\"\nC:\\tmp\ttab")
+	want := `'O\'Tester said \"hi\"\nC:\\tmp` + "\t" + `tab'`
+
+	if !cmp.Equal(got, want) {
+		t.Errorf("quoteString got = %v, want = %v", got, want)
+	}
+}
+
+func TestStripAutoIncrement(t *testing.T) {
+	createSQL := "CREATE TABLE `records` (\n  `recordID` mediumint unsigned NOT NULL AUTO_INCREMENT,\n  PRIMARY KEY (`recordID`)\n) ENGINE=InnoDB AUTO_INCREMENT=1024 DEFAULT CHARSET=utf8mb4"
+	got := stripAutoIncrement(createSQL)
+	want := "CREATE TABLE `records` (\n  `recordID` mediumint unsigned NOT NULL AUTO_INCREMENT,\n  PRIMARY KEY (`recordID`)\n) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"
+
+	if !cmp.Equal(got, want) {
+		t.Errorf("stripAutoIncrement got = %v, want = %v", got, want)
+	}
+}
+
+func TestFormatValue(t *testing.T) {
+	d := dumper{}
+
+	tests := []struct {
+		name  string
+		col   column
+		value sql.RawBytes
+		want  string
+	}{
+		{"null", column{Name: "parentID", DataType: "smallint"}, nil, "NULL"},
+		{"numeric", column{Name: "recordID", DataType: "mediumint"}, sql.RawBytes("958"), "958"},
+		{"text", column{Name: "title", DataType: "text"}, sql.RawBytes("It's done"), `'It\'s done'`},
+		{"empty text", column{Name: "title", DataType: "text"}, sql.RawBytes(""), `''`},
+		{"on update timestamp", column{Name: "updated", DataType: "timestamp", Extra: "DEFAULT_GENERATED on update CURRENT_TIMESTAMP"}, sql.RawBytes("2025-07-16 03:27:37"), `'2000-01-01 00:00:00'`},
+		{"default timestamp", column{Name: "created", DataType: "timestamp", Extra: "DEFAULT_GENERATED"}, sql.RawBytes("2025-07-16 03:27:37"), `'2025-07-16 03:27:37'`},
+	}
+
+	for _, tc := range tests {
+		got := d.formatValue(tc.col, tc.value)
+		if !cmp.Equal(got, tc.want) {
+			t.Errorf("%s: formatValue got = %v, want = %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestColumn_Generated(t *testing.T) {
+	if (column{Extra: "DEFAULT_GENERATED"}).generated() {
+		t.Errorf("DEFAULT_GENERATED columns should be exported")
+	}
+	if !(column{Extra: "VIRTUAL GENERATED"}).generated() {
+		t.Errorf("VIRTUAL GENERATED columns should not be exported")
+	}
+}
@@ -0,0 +1,91 @@
+// fixturedump exports the API test databases from a running LEAF development
+// environment into the SQL fixtures under API-tests/database.
+//
+// Output is deterministic: tables are sorted by name, rows are sorted by primary
+// key, each row is written as its own INSERT statement, AUTO_INCREMENT counters
+// are dropped from table definitions, and columns maintained by
+// ON UPDATE CURRENT_TIMESTAMP are pinned to a fixed value. Re-exporting an
+// unchanged database produces no diff, so fixture updates only show the rows
+// that actually changed.
+//
+// Usage (from the API-tests directory, with the LEAF environment running):
+//
+//	go run ./cmd/fixturedump
+//	go run ./cmd/fixturedump -only portal_test_db.sql -scrub
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// fixtures maps each fixture file to the database it is loaded into by
+// setupTestDB (see dbsetup_test.go). Keep these in sync.
+var fixtures = []struct {
+	File     string
+	Database string
+}{
+	{"portal_test_db.sql", "leaf_portal_API_testing"},
+	{"nexus_test_db.sql", "leaf_users_API_testing"},
+	{"library_test_db.sql", "leaf_library_testing"},
+	{"platform_privacy_test_db.sql", "leaf_platform_privacy_testing"},
+	{"portal_agent_db.sql", "leaf_agent"},
+}
+
+// volatileTables only have their schema exported; their contents are runtime
+// state that should never be part of a fixture.
+var volatileTables = map[string]bool{
+	"cache":      true,
+	"data_cache": true,
+	"sessions":   true,
+}
+
+func main() {
+	outDir := flag.String("out", "database", "directory the fixture files are written to")
+	only := flag.String("only", "", "comma separated list of fixture files to export (default: all)")
+	scrub := flag.Bool("scrub", false, "replace values that look like PII (emails, phone numbers, SSNs) with stable fakes")
+	flag.Parse()
+
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+
+	dsn := os.Getenv("MYSQL_USER") + ":" + os.Getenv("MYSQL_PASSWORD") + "@(" + os.Getenv("MYSQL_HOST") + ")/"
+
+	selected := map[string]bool{}
+	for _, f := range strings.Split(*only, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			selected[f] = true
+		}
+	}
+
+	for _, fixture := range fixtures {
+		if len(selected) > 0 && !selected[fixture.File] {
+			continue
+		}
+
+		// Render TIMESTAMP columns in UTC regardless of the server's zone
+		db, err := sql.Open("mysql", dsn+fixture.Database+"?time_zone=%27%2B00%3A00%27")
+		if err != nil {
+			log.Fatal("Couldn't open database, check DSN: ", err.Error())
+		}
+
+		d := dumper{db: db, schema: fixture.Database, scrub: *scrub}
+		out, err := d.dumpDatabase()
+		db.Close()
+		if err != nil {
+			log.Fatalf("Could not export %s: %v", fixture.Database, err)
+		}
+
+		path := filepath.Join(*outDir, fixture.File)
+		if err := os.WriteFile(path, []byte(out), 0664); err != nil {
+			log.Fatalf("Could not write %s: %v", path, err)
+		}
+		fmt.Printf("Exported %s -> %s\n", fixture.Database, path)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// fakeEmailDomain is used throughout the fixtures for generated users, so
+// addresses on it are already safe to commit.
+const fakeEmailDomain = "fake-email.com"
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	ssnPattern   = regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`)
+	phonePattern = regexp.MustCompile(`(?:\(\d{3}\)\s?|\b\d{3}[-. ])\d{3}[-. ]\d{4}\b`)
+)
+
+// scrubPII replaces anything in s that looks like an email address, phone
+// number or SSN. Replacements are derived from a hash of the original value so
+// repeated exports stay stable and the same person maps to the same fake.
+func scrubPII(s string) string {
+	s = emailPattern.ReplaceAllStringFunc(s, func(email string) string {
+		if strings.HasSuffix(strings.ToLower(email), "@"+fakeEmailDomain) {
+			return email
+		}
+		return "user." + shortHash(strings.ToLower(email)) + "@" + fakeEmailDomain
+	})
+	s = ssnPattern.ReplaceAllString(s, "000-00-0000")
+	s = phonePattern.ReplaceAllStringFunc(s, func(phone string) string {
+		return "555-555-01" + hashDigits(phone)[:2]
+	})
+	return s
+}
+
+func shortHash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:4])
+}
+
+// hashDigits returns a stable string of decimal digits derived from s
+func hashDigits(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	var sb strings.Builder
+	for _, b := range sum[:4] {
+		fmt.Fprintf(&sb, "%d", b%10)
+	}
+	return sb.String()
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestScrubPII_KeepsFakeEmails(t *testing.T) {
+	in := `{"email": "tester.tester@fake-email.com", "userName": "tester"}`
+	got := scrubPII(in)
+
+	if !cmp.Equal(got, in) {
+		t.Errorf("scrubPII changed an address that is already fake. got = %v, want = %v", got, in)
+	}
+}
+
+func TestScrubPII_ReplacesRealEmailsStably(t *testing.T) {
+	in := "Contact jane.doe@va.gov or JANE.DOE@va.gov"
+	got := scrubPII(in)
+
+	if strings.Contains(got, "va.gov") {
+		t.Errorf("scrubPII left a real address in place: %v", got)
+	}
+
+	fields := strings.Fields(got)
+	if fields[1] != fields[3] {
+		t.Errorf("the same address should map to the same fake regardless of case. got = %v, %v", fields[1], fields[3])
+	}
+
+	if scrubPII(in) != got {
+		t.Errorf("scrubPII should be deterministic")
+	}
+}
+
+func TestScrubPII_PhoneAndSSN(t *testing.T) {
+	got := scrubPII("SSN 123-45-6789, phone (202) 555-1234, alt 202.867.5309")
+
+	for _, leaked := range []string{"123-45-6789", "555-1234", "867.5309"} {
+		if strings.Contains(got, leaked) {
+			t.Errorf("scrubPII left %v in %v", leaked, got)
+		}
+	}
+
+	if !strings.Contains(got, "000-00-0000") {
+		t.Errorf("SSN should be replaced with 000-00-0000, got = %v", got)
+	}
+}
+
+func TestScrubPII_LeavesTimestampsAlone(t *testing.T) {
+	in := "2023-08-17 16:01:21 1692287010"
+	got := scrubPII(in)
+
+	if !cmp.Equal(got, in) {
+		t.Errorf("scrubPII got = %v, want = %v", got, in)
+	}
+}
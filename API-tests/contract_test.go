@@ -0,0 +1,303 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Strict mode compares every response decoded through decodeJSON with the Go
+// type it's decoded into, and prints the differences per endpoint after the run:
+//
+//	go test -strict
+var strictContracts = flag.Bool("strict", false, "report unknown fields, missing fields and type mismatches between API responses and the Go response types")
+
+var unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+var routeIDSegment = regexp.MustCompile(`^-?\d+$`)
+var routeFormSegment = regexp.MustCompile(`^_?form_[0-9a-f]+$`)
+
+// contractDrift collects the differences found in strict mode
+type contractDrift struct {
+	mu     sync.Mutex
+	issues map[string]map[string]int // endpoint -> issue -> occurrences
+	fields map[string]map[string]*contractFields
+}
+
+// contractFields tracks which declared fields of a struct an endpoint ever returned
+type contractFields struct {
+	declared []string
+	seen     map[string]bool
+}
+
+var drift = contractDrift{
+	issues: map[string]map[string]int{},
+	fields: map[string]map[string]*contractFields{},
+}
+
+// decodeJSON unmarshals a response from url into v. In strict mode it also
+// records how the response differs from v's type.
+func decodeJSON(url string, b []byte, v any) error {
+	err := json.Unmarshal(b, v)
+
+	recordResponseType(url, reflect.TypeOf(v).Elem())
+
+	if *strictContracts {
+		var raw any
+		d := json.NewDecoder(strings.NewReader(string(b)))
+		d.UseNumber()
+		if d.Decode(&raw) == nil {
+			drift.check(routeTemplate(url), "$", raw, reflect.TypeOf(v).Elem())
+		} else {
+			drift.add(routeTemplate(url), "response is not JSON")
+		}
+	}
+
+	return err
+}
+
+// routeTemplate reduces a URL to its endpoint, e.g. /Test_Request_Portal/api/formWorkflow/{id}/currentStep
+func routeTemplate(url string) string {
+	url = strings.TrimPrefix(url, HostURL)
+	if i := strings.IndexAny(url, "?#"); i >= 0 {
+		url = url[:i]
+	}
+
+	segments := strings.Split(strings.TrimSuffix(url, "/"), "/")
+	for i, s := range segments {
+		switch {
+		case routeIDSegment.MatchString(s):
+			segments[i] = "{id}"
+		case routeFormSegment.MatchString(s):
+			segments[i] = "{categoryID}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func (c *contractDrift) add(endpoint string, issue string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.issues[endpoint] == nil {
+		c.issues[endpoint] = map[string]int{}
+	}
+	c.issues[endpoint][issue]++
+}
+
+// check walks raw alongside t, recording unknown fields and type mismatches
+func (c *contractDrift) check(endpoint string, path string, raw any, t reflect.Type) {
+	if t.Kind() == reflect.Interface || t.Implements(unmarshalerType) || reflect.PointerTo(t).Implements(unmarshalerType) {
+		return
+	}
+	if raw == nil {
+		// null decodes into these as nil; anything else silently keeps its zero value
+		switch t.Kind() {
+		case reflect.Pointer, reflect.Slice, reflect.Map:
+		default:
+			c.add(endpoint, fmt.Sprintf("type mismatch at %s: got null, want %s", path, t.Kind()))
+		}
+		return
+	}
+	if t.Kind() == reflect.Pointer {
+		c.check(endpoint, path, raw, t.Elem())
+		return
+	}
+
+	got := jsonKind(raw)
+	switch t.Kind() {
+	case reflect.String:
+		if got != "string" {
+			c.add(endpoint, fmt.Sprintf("type mismatch at %s: got %s, want string", path, got))
+		}
+	case reflect.Bool:
+		if got != "boolean" {
+			c.add(endpoint, fmt.Sprintf("type mismatch at %s: got %s, want boolean", path, got))
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		if got != "number" {
+			c.add(endpoint, fmt.Sprintf("type mismatch at %s: got %s, want number", path, got))
+		}
+	case reflect.Slice, reflect.Array:
+		items, ok := raw.([]any)
+		if !ok {
+			c.add(endpoint, fmt.Sprintf("type mismatch at %s: got %s, want array", path, got))
+			return
+		}
+		for _, item := range items {
+			c.check(endpoint, path+"[]", item, t.Elem())
+		}
+	case reflect.Map:
+		obj, ok := raw.(map[string]any)
+		if !ok {
+			c.add(endpoint, fmt.Sprintf("type mismatch at %s: got %s, want object", path, got))
+			return
+		}
+		for k, v := range obj {
+			if isIntKind(t.Key().Kind()) {
+				if _, err := strconv.ParseInt(k, 10, 64); err != nil {
+					c.add(endpoint, fmt.Sprintf("type mismatch at %s: key %q is not a number", path, k))
+				}
+			}
+			c.check(endpoint, path+".*", v, t.Elem())
+		}
+	case reflect.Struct:
+		obj, ok := raw.(map[string]any)
+		if !ok {
+			c.add(endpoint, fmt.Sprintf("type mismatch at %s: got %s, want object", path, got))
+			return
+		}
+		fields := jsonFields(t)
+		structPath := path
+		if t.Name() != "" {
+			structPath += " (" + t.Name() + ")"
+		}
+		seen := c.seenFields(endpoint, structPath, fields)
+		for k, v := range obj {
+			f, ok := fields[strings.ToLower(k)]
+			if !ok {
+				c.add(endpoint, fmt.Sprintf("unknown field %s.%s (%s)", path, k, jsonKind(v)))
+				continue
+			}
+			c.mu.Lock()
+			seen[f.name] = true
+			c.mu.Unlock()
+			c.check(endpoint, path+"."+k, v, f.typ)
+		}
+	}
+}
+
+// seenFields returns the set of fields of a struct returned so far by an endpoint
+func (c *contractDrift) seenFields(endpoint string, path string, fields map[string]jsonField) map[string]bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.fields[endpoint] == nil {
+		c.fields[endpoint] = map[string]*contractFields{}
+	}
+	cf := c.fields[endpoint][path]
+	if cf == nil {
+		cf = &contractFields{seen: map[string]bool{}}
+		for _, f := range fields {
+			if !f.omitempty {
+				cf.declared = append(cf.declared, f.name)
+			}
+		}
+		c.fields[endpoint][path] = cf
+	}
+	return cf.seen
+}
+
+// report summarizes drift per endpoint. A field counts as missing only if the
+// endpoint never returned it, since joins and x-filterData change which fields appear.
+func (c *contractDrift) report() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for endpoint, structs := range c.fields {
+		for path, cf := range structs {
+			for _, name := range cf.declared {
+				if !cf.seen[name] {
+					if c.issues[endpoint] == nil {
+						c.issues[endpoint] = map[string]int{}
+					}
+					c.issues[endpoint][fmt.Sprintf("missing field %s.%s (never returned)", path, name)] = 0
+				}
+			}
+		}
+	}
+
+	if len(c.issues) == 0 {
+		return "Contract check: no drift found\n"
+	}
+
+	endpoints := make([]string, 0, len(c.issues))
+	for endpoint := range c.issues {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Strings(endpoints)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Contract check: drift found in %d endpoint(s)\n", len(endpoints))
+	for _, endpoint := range endpoints {
+		issues := make([]string, 0, len(c.issues[endpoint]))
+		for issue := range c.issues[endpoint] {
+			issues = append(issues, issue)
+		}
+		sort.Strings(issues)
+
+		fmt.Fprintf(&sb, "\n%s\n", endpoint)
+		for _, issue := range issues {
+			if n := c.issues[endpoint][issue]; n > 1 {
+				fmt.Fprintf(&sb, "    %s (x%d)\n", issue, n)
+			} else {
+				fmt.Fprintf(&sb, "    %s\n", issue)
+			}
+		}
+	}
+	return sb.String()
+}
+
+type jsonField struct {
+	name      string
+	typ       reflect.Type
+	omitempty bool
+}
+
+// jsonFields lists a struct's fields by lowercased JSON name, the way
+// encoding/json matches keys, including fields of embedded structs
+func jsonFields(t reflect.Type) map[string]jsonField {
+	fields := map[string]jsonField{}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" || (!sf.IsExported() && !sf.Anonymous) {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if sf.Anonymous && name == "" && sf.Type.Kind() == reflect.Struct {
+			for k, f := range jsonFields(sf.Type) {
+				fields[k] = f
+			}
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		fields[strings.ToLower(name)] = jsonField{name: name, typ: sf.Type, omitempty: strings.Contains(opts, "omitempty")}
+	}
+	return fields
+}
+
+func jsonKind(v any) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case bool:
+		return "boolean"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return "null"
+}
+
+func isIntKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
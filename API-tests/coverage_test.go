@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Endpoint coverage compares the routes the suite calls with a route inventory
+// taken from LEAF's API controllers. Point the flags at the controller
+// directories of a LEAF checkout, or at text files with one
+// "METHOD route Controller" per line:
+//
+//	go test -coverage.portal=../../LEAF/LEAF_Request_Portal/api/controllers -coverage.nexus=../../LEAF/LEAF_Nexus/api/controllers
+var coveragePortalRoutes = flag.String("coverage.portal", "", "Request Portal route inventory: api/controllers directory or route list file")
+var coverageNexusRoutes = flag.String("coverage.nexus", "", "Nexus route inventory: api/controllers directory or route list file")
+var coverageOut = flag.String("coverage.out", "", "also write the endpoint coverage report to this file")
+
+// registerPattern matches route registrations such as
+// $this->index['GET']->register('form/[digit]/data', function ($args) {
+var registerPattern = regexp.MustCompile(`index\[['"](GET|POST|DELETE|PUT)['"]\]->register\(\s*['"]([^'"]+)['"]`)
+
+var routeParamPattern = regexp.MustCompile(`\\\[\w+\\\]`)
+
+type apiRoute struct {
+	Method     string
+	Pattern    string
+	Controller string
+	match      *regexp.Regexp
+}
+
+type observedCall struct {
+	Site   string
+	Method string
+	Path   string // relative to the site's api/ directory
+}
+
+var coverageCalls = map[observedCall]bool{}
+var mxCoverageCalls sync.Mutex
+
+// coverageEnabled reports whether any route inventory was given
+func coverageEnabled() bool {
+	return *coveragePortalRoutes != "" || *coverageNexusRoutes != ""
+}
+
+// coverageSites maps each inventory to the URLs of the test sites using it
+func coverageSites() map[string][]string {
+	return map[string][]string{
+		"portal": {RootURL, LibraryURL, PlatformPrivacyURL},
+		"nexus":  {RootOrgchartURL, NationalOrgchartURL},
+	}
+}
+
+// recordCoverage is a trafficObserver
+func recordCoverage(ex *exchange) {
+	u := ex.Request.URL.String()
+	for site, siteURLs := range coverageSites() {
+		for _, siteURL := range siteURLs {
+			if !strings.HasPrefix(u, siteURL+"api/") {
+				continue
+			}
+			path := strings.TrimPrefix(u, siteURL+"api/")
+			if i := strings.IndexAny(path, "?#"); i >= 0 {
+				path = path[:i]
+			}
+			if unescaped, err := url.PathUnescape(path); err == nil {
+				path = unescaped
+			}
+
+			mxCoverageCalls.Lock()
+			coverageCalls[observedCall{Site: site, Method: ex.Request.Method, Path: strings.Trim(path, "/")}] = true
+			mxCoverageCalls.Unlock()
+			return
+		}
+	}
+}
+
+// loadRouteInventory reads routes from PHP controllers or from a route list file
+func loadRouteInventory(path string) ([]apiRoute, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var routes []apiRoute
+	if info.IsDir() {
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || !strings.HasSuffix(p, ".php") {
+				return err
+			}
+			b, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			controller := strings.TrimSuffix(filepath.Base(p), ".php")
+			for _, m := range registerPattern.FindAllStringSubmatch(string(b), -1) {
+				routes = append(routes, newAPIRoute(m[1], m[2], controller))
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+				continue
+			}
+			controller := "(unknown)"
+			if len(fields) > 2 {
+				controller = fields[2]
+			}
+			routes = append(routes, newAPIRoute(fields[0], fields[1], controller))
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Controller != routes[j].Controller {
+			return routes[i].Controller < routes[j].Controller
+		}
+		if routes[i].Pattern != routes[j].Pattern {
+			return routes[i].Pattern < routes[j].Pattern
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes, nil
+}
+
+// newAPIRoute compiles a LEAF route pattern; [digit] matches a number and other
+// placeholders such as [text] match one path segment
+func newAPIRoute(method string, pattern string, controller string) apiRoute {
+	pattern = strings.Trim(pattern, "/")
+	// QuoteMeta escapes the placeholders' brackets, so they're matched escaped
+	expr := routeParamPattern.ReplaceAllStringFunc(regexp.QuoteMeta(pattern), func(s string) string {
+		if s == `\[digit\]` {
+			return `-?\d+`
+		}
+		return `[^/]+`
+	})
+
+	return apiRoute{
+		Method:     strings.ToUpper(method),
+		Pattern:    pattern,
+		Controller: controller,
+		match:      regexp.MustCompile(`^` + expr + `$`),
+	}
+}
+
+// coverageReport lists covered and uncovered routes per controller for each inventory
+func coverageReport() (string, error) {
+	inventories := map[string]string{"portal": *coveragePortalRoutes, "nexus": *coverageNexusRoutes}
+
+	mxCoverageCalls.Lock()
+	defer mxCoverageCalls.Unlock()
+
+	var sb strings.Builder
+	var totalRoutes, totalCovered int
+	for _, site := range []string{"portal", "nexus"} {
+		if inventories[site] == "" {
+			continue
+		}
+		routes, err := loadRouteInventory(inventories[site])
+		if err != nil {
+			return "", fmt.Errorf("%s route inventory: %w", site, err)
+		}
+
+		matched := map[observedCall]bool{}
+		covered := 0
+		fmt.Fprintf(&sb, "\n== %s (%s)\n", site, inventories[site])
+
+		controller := ""
+		var lines []string
+		var controllerCovered, controllerTotal int
+		flush := func() {
+			if controller != "" {
+				fmt.Fprintf(&sb, "\n%s: %d/%d\n%s", controller, controllerCovered, controllerTotal, strings.Join(lines, ""))
+			}
+			lines, controllerCovered, controllerTotal = nil, 0, 0
+		}
+
+		for _, route := range routes {
+			if route.Controller != controller {
+				flush()
+				controller = route.Controller
+			}
+
+			hit := false
+			for call := range coverageCalls {
+				if call.Site == site && call.Method == route.Method && route.match.MatchString(call.Path) {
+					hit = true
+					matched[call] = true
+				}
+			}
+
+			mark := " "
+			if hit {
+				mark = "x"
+				covered++
+				controllerCovered++
+			}
+			controllerTotal++
+			lines = append(lines, fmt.Sprintf("    [%s] %-6s %s\n", mark, route.Method, route.Pattern))
+		}
+		flush()
+
+		// Calls that don't match the inventory usually mean it's out of date
+		var unknown []string
+		for call := range coverageCalls {
+			if call.Site == site && !matched[call] {
+				unknown = append(unknown, fmt.Sprintf("    %-6s %s\n", call.Method, call.Path))
+			}
+		}
+		sort.Strings(unknown)
+		if len(unknown) > 0 {
+			fmt.Fprintf(&sb, "\nCalled but not in the inventory:\n%s", strings.Join(unknown, ""))
+		}
+
+		fmt.Fprintf(&sb, "\n%s endpoint coverage: %d/%d routes (%.1f%%)\n", site, covered, len(routes), percent(covered, len(routes)))
+		totalRoutes += len(routes)
+		totalCovered += covered
+	}
+
+	fmt.Fprintf(&sb, "\nEndpoint coverage: %d/%d routes (%.1f%%)\n", totalCovered, totalRoutes, percent(totalCovered, totalRoutes))
+	return sb.String(), nil
+}
+
+func percent(n int, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(n) / float64(total)
+}
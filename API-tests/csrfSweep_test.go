@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// csrfEndpoint is a state-changing request the suite makes. The body holds
+// valid parameters, so a rejection can only come from the CSRF check.
+type csrfEndpoint struct {
+	method string
+	url    string
+	body   url.Values
+}
+
+// csrfEndpoints covers every POST and DELETE endpoint used by the suite. LEAF
+// reads the token of a DELETE from the query string, and of a POST from the body.
+var csrfEndpoints = []csrfEndpoint{
+	{"POST", RootURL + "api/form/505", url.Values{"3": {"12345"}}},
+	{"POST", RootURL + "api/form/new", url.Values{"numform_5ea07": {"1"}, "title": {"CSRF sweep"}}},
+	{"POST", RootURL + "api/form/12/initiator", url.Values{"initiator": {"tester"}}},
+	{"POST", RootURL + "api/formWorkflow/8/apply", url.Values{"dependencyID": {"-3"}, "actionType": {"approve"}}},
+	{"POST", RootURL + "api/formWorkflow/17/step", url.Values{"stepID": {"2"}}},
+	{"POST", RootURL + "api/formEditor/new", url.Values{"name": {"CSRF sweep"}, "description": {"CSRF sweep"}}},
+	{"POST", RootURL + "api/formEditor/3/name", url.Values{"name": {"CSRF sweep"}}},
+	{"POST", RootURL + "api/workflow/new", url.Values{"description": {"CSRF sweep"}}},
+	{"POST", RootURL + "api/workflow/1/step", url.Values{"stepTitle": {"CSRF sweep"}}},
+	{"POST", RootURL + "api/workflow/1/editorPosition", url.Values{"stepID": {"1"}, "x": {"1"}, "y": {"1"}}},
+	{"POST", RootURL + "api/workflow/dependencies", url.Values{"description": {"CSRF sweep"}}},
+	{"POST", RootURL + "api/workflow/dependency/-4", url.Values{"description": {"CSRF sweep"}}},
+	{"POST", RootURL + "api/workflow/dependency/9/privileges", url.Values{"groupID": {"1"}}},
+	{"POST", RootURL + "api/workflow/step/1/dependencies", url.Values{"dependencyID": {"-2"}}},
+	{"POST", RootURL + "api/workflow/step/1/indicatorID_for_assigned_empUID", url.Values{"indicatorID": {"3"}}},
+	{"POST", RootURL + "api/workflow/step/1/indicatorID_for_assigned_groupID", url.Values{"indicatorID": {"3"}}},
+	{"POST", RootURL + "api/workflow/events", url.Values{"name": {"CSRF_sweep"}, "description": {"CSRF sweep"}, "type": {"Email"}}},
+	{"POST", RootURL + "api/system/action", url.Values{"actionText": {"CSRF sweep"}, "actionTextPasttense": {"CSRF swept"}, "sort": {"0"}, "fillDependency": {"1"}}},
+	{"POST", RootURL + "api/emailTemplates/_LEAF_notify_next_body.tpl", url.Values{"file": {"CSRF sweep"}, "subjectFile": {"CSRF sweep"}, "subjectFileName": {"LEAF_notify_next_subject.tpl"}}},
+	{"POST", RootURL + "api/open/report", url.Values{"data": {"/?a=reports&csrf=sweep"}}},
+	{"POST", RootURL + "api/open/form/query", url.Values{"data": {`{"terms":[],"joins":[],"sort":{}}`}}},
+	{"DELETE", RootURL + "api/workflow/step/1/dependencies?dependencyID=9&workflowID=1", nil},
+	{"DELETE", RootURL + "api/workflow/step/2", nil},
+	{"DELETE", RootURL + "api/workflow/1", nil},
+	{"DELETE", RootURL + "api/workflow/action/_sendback", nil},
+	{"DELETE", RootURL + "api/emailTemplates/_LEAF_notify_next_body.tpl?subjectFileName=LEAF_notify_next_subject.tpl&emailToFileName=LEAF_notify_next_emailTo.tpl&emailCcFileName=LEAF_notify_next_emailCc.tpl", nil},
+	{"POST", RootOrgchartURL + "api/group", url.Values{"title": {"CSRF sweep"}}},
+	{"POST", RootOrgchartURL + "api/group/14/tag", url.Values{"tag": {"CSRF_sweep"}}},
+	{"DELETE", RootOrgchartURL + "api/group/14/tag?tag=Academy_Demo1", nil},
+	{"DELETE", RootOrgchartURL + "api/group/14", nil},
+	{"POST", RootOrgchartURL + "api/employee/new", url.Values{"firstName": {"CSRF"}, "lastName": {"Sweep"}, "userName": {"csrfsweep"}}},
+	{"POST", RootOrgchartURL + "api/employee/11/activate", nil},
+	{"DELETE", RootOrgchartURL + "api/employee/11", nil},
+}
+
+// csrfVolatileTables change on reads, e.g. when a session starts
+var csrfVolatileTables = map[string]bool{
+	"sessions":   true,
+	"cache":      true,
+	"data_cache": true,
+}
+
+// checksumTestDBs returns CHECKSUM TABLE for every table in the portal and nexus test databases
+func checksumTestDBs(t *testing.T) map[string]string {
+	t.Helper()
+
+	db := getDB()
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT TABLE_SCHEMA, TABLE_NAME FROM information_schema.TABLES
+		WHERE TABLE_SCHEMA IN (?, ?) AND TABLE_TYPE = 'BASE TABLE'`, testPortalDbName, testNexusDbName)
+	if err != nil {
+		t.Fatalf("Could not list tables: %v", err)
+	}
+	var tables []string
+	for rows.Next() {
+		var schema, table string
+		rows.Scan(&schema, &table)
+		if !csrfVolatileTables[table] {
+			tables = append(tables, "`"+schema+"`.`"+table+"`")
+		}
+	}
+	rows.Close()
+
+	rows, err = db.Query("CHECKSUM TABLE " + strings.Join(tables, ", "))
+	if err != nil {
+		t.Fatalf("Could not checksum tables: %v", err)
+	}
+	defer rows.Close()
+
+	sums := map[string]string{}
+	for rows.Next() {
+		var table string
+		var sum *string
+		rows.Scan(&table, &sum)
+		if sum != nil {
+			sums[table] = *sum
+		}
+	}
+	return sums
+}
+
+// changedTables lists the tables whose checksums differ
+func changedTables(before map[string]string, after map[string]string) []string {
+	var changed []string
+	for table, sum := range after {
+		if before[table] != sum {
+			changed = append(changed, table)
+		}
+	}
+	for table := range before {
+		if _, exists := after[table]; !exists {
+			changed = append(changed, table)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// otherSessionToken starts a second session for the same user and returns its CSRF token
+func otherSessionToken(t *testing.T) (string, *http.Client) {
+	t.Helper()
+
+	other := newUnauthenticatedClient()
+	res, err := other.Get(RootURL)
+	if err != nil {
+		t.Fatalf("Could not start a second session: %v", err)
+	}
+	defer res.Body.Close()
+	b, _ := io.ReadAll(res.Body)
+
+	token := readCSRFToken(string(b))
+	if token == "" || token == CsrfToken {
+		t.Fatalf("second session's CSRF token = %q, want a token different from this session's", token)
+	}
+	return token, other
+}
+
+// endSession deletes a session's rows, so its token becomes stale
+func endSession(t *testing.T, c *http.Client) {
+	t.Helper()
+
+	db := getDB()
+	defer db.Close()
+
+	for _, site := range []string{RootURL, RootOrgchartURL} {
+		u, _ := url.Parse(site)
+		for _, cookie := range c.Jar.Cookies(u) {
+			for _, dbName := range []string{testPortalDbName, testNexusDbName} {
+				if _, err := db.Exec("DELETE FROM `"+dbName+"`.sessions WHERE sessionKey = ?", cookie.Value); err != nil {
+					t.Fatalf("Could not end session: %v", err)
+				}
+			}
+		}
+	}
+}
+
+// sendWithToken makes the request through this session, with token in place of
+// the session's CSRF token. A nil token leaves CSRFToken out.
+func (e csrfEndpoint) sendWithToken(token *string) (*http.Response, error) {
+	body := url.Values{}
+	for k, v := range e.body {
+		body[k] = v
+	}
+
+	target := e.url
+	if token != nil {
+		if e.method == "DELETE" {
+			sep := "?"
+			if strings.Contains(target, "?") {
+				sep = "&"
+			}
+			target += sep + "CSRFToken=" + url.QueryEscape(*token)
+		}
+		body.Set("CSRFToken", *token)
+	}
+
+	req, err := http.NewRequest(e.method, target, strings.NewReader(body.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return client.Do(req)
+}
+
+// TestCSRF_Sweep sends every state-changing endpoint a missing, empty, stale
+// and other-session CSRF token. Each request must be rejected with 401 and
+// leave the database unchanged.
+func TestCSRF_Sweep(t *testing.T) {
+	stale, staleClient := otherSessionToken(t)
+	endSession(t, staleClient)
+	otherSession, _ := otherSessionToken(t)
+	empty := ""
+
+	tokens := []struct {
+		name  string
+		token *string
+	}{
+		{"missing", nil},
+		{"empty", &empty},
+		{"stale", &stale},
+		{"other session", &otherSession},
+	}
+
+	before := checksumTestDBs(t)
+	for _, e := range csrfEndpoints {
+		for _, tc := range tokens {
+			name := fmt.Sprintf("%s %s with %s token", e.method, strings.TrimPrefix(e.url, HostURL), tc.name)
+
+			res, err := e.sendWithToken(tc.token)
+			if err != nil {
+				t.Errorf("%s: %v", name, err)
+				continue
+			}
+			b, _ := io.ReadAll(res.Body)
+			res.Body.Close()
+
+			if res.StatusCode != http.StatusUnauthorized {
+				t.Errorf("%s: status = %v, want = %v: %v", name, res.StatusCode, http.StatusUnauthorized, truncateString(string(b), 200))
+			}
+
+			after := checksumTestDBs(t)
+			if changed := changedTables(before, after); len(changed) > 0 {
+				t.Errorf("%s changed the database: %v", name, strings.Join(changed, ", "))
+			}
+			before = after
+		}
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"database/sql"
+	"flag"
 	"fmt"
 	"log"
 	"os"
@@ -13,8 +14,24 @@ var origPortalDbName, origNexusDbName string
 var origNexusDbNameForNexus string
 var mysqlDSN = dbUsername + ":" + dbPassword + "@(" + dbHost + ")/?multiStatements=true"
 
+// Alternate dumps let the suite start from an older release's database, so that
+// updateDatabase.php is exercised against a real upgrade path. See database/archive.
+var portalSqlPath = flag.String("portal.sql", "database/portal_test_db.sql", "portal database dump loaded into "+testPortalDbName)
+var nexusSqlPath = flag.String("nexus.sql", "database/nexus_test_db.sql", "nexus database dump loaded into "+testNexusDbName)
+
+var abortSchemaUpdateOnce sync.Once
+
+// abortSchemaUpdate restores the dev environment before exiting, so a failed
+// migration doesn't leave the sites table pointing at the test databases
+func abortSchemaUpdate(msg string) {
+	abortSchemaUpdateOnce.Do(func() {
+		teardownTestDB()
+		log.Fatal(msg)
+	})
+}
+
 func getDB() *sql.DB {
-	db, err := sql.Open("mysql", mysqlDSN)
+	db, err := sql.Open(dbDriver, mysqlDSN)
 	if err != nil {
 		log.Fatal("Couldn't open database, check DSN: ", err.Error())
 	}
@@ -34,13 +51,13 @@ func setupTestDB() {
 	defer db.Close()
 
 	// Prep switchover to test DB
-	f, err := os.ReadFile("database/portal_test_db.sql")
+	f, err := os.ReadFile(*portalSqlPath)
 	if err != nil {
 		log.Fatal("Couldn't open the file: ", err.Error())
 	}
 	importPortalSql := string(f)
 
-	f, err = os.ReadFile("database/nexus_test_db.sql")
+	f, err = os.ReadFile(*nexusSqlPath)
 	if err != nil {
 		log.Fatal("Couldn't open the file: ", err.Error())
 	}
@@ -191,7 +208,7 @@ func updateTestDBSchema() {
 
 		res, _ := httpGet(RootURL + `scripts/updateDatabase.php`)
 		if strings.Contains(res, `Db Update failed`) {
-			log.Fatal(`Could not update Request Portal schema: ` + res)
+			abortSchemaUpdate(`Could not update Request Portal schema: ` + res)
 		}
 		fmt.Println("Updated DB Schema: Request Portal... OK")
 	}()
@@ -201,7 +218,7 @@ func updateTestDBSchema() {
 
 		res, _ := httpGet(RootOrgchartURL + `scripts/updateDatabase.php`)
 		if strings.Contains(res, `Db Update failed`) {
-			log.Fatal(`Could not update Nexus (Orgchart) schema: ` + res)
+			abortSchemaUpdate(`Could not update Nexus (Orgchart) schema: ` + res)
 		}
 		fmt.Println("Updated DB Schema: Local Nexus (Orgchart)... OK")
 		//the LEAF_Nexus dir maps to the LEAF_NationalNexus, LEAF_Nexus and Test_Nexus docker volumes
@@ -212,7 +229,7 @@ func updateTestDBSchema() {
 
 		res, _ := httpGet(NationalOrgchartURL + `scripts/updateDatabase.php`)
 		if strings.Contains(res, `Db Update failed`) {
-			log.Fatal(`Could not update Nexus (Orgchart) schema: ` + res)
+			abortSchemaUpdate(`Could not update Nexus (Orgchart) schema: ` + res)
 		}
 		fmt.Println("Updated DB Schema: National Nexus (Orgchart)... OK")
 	}()
@@ -223,7 +240,7 @@ func updateTestDBSchema() {
 		//LEAF_Request_Portal dir maps to LEAF_Request_Portal, Test_Request_Portal and LEAF/library Docker volumes
 		res, _ := httpGet(LibraryURL + `scripts/updateDatabase.php`)
 		if strings.Contains(res, `Db Update failed`) {
-			log.Fatal(`Could not update LEAF Library schema: ` + res)
+			abortSchemaUpdate(`Could not update LEAF Library schema: ` + res)
 		}
 		fmt.Println("Updated DB Schema: LEAF Library ... OK")
 	}()
@@ -233,7 +250,7 @@ func updateTestDBSchema() {
 
 		res, _ := httpGet(PlatformPrivacyURL + `scripts/updateDatabase.php`)
 		if strings.Contains(res, `Db Update failed`) {
-			log.Fatal(`Could not update Platform Privacy schema: ` + res)
+			abortSchemaUpdate(`Could not update Platform Privacy schema: ` + res)
 		}
 		fmt.Println("Updated DB Schema: Platform Privacy ... OK")
 	}()
@@ -244,7 +261,7 @@ func updateTestDBSchema() {
 		// Update DB Schema: Portal Agent
 		res, _ := httpGet(HostURL + `/platform/agent/scripts/updateDatabase.php`)
 		if strings.Contains(res, `Db Update failed`) {
-			log.Fatal(`Could not update Platform Agent schema: ` + res)
+			abortSchemaUpdate(`Could not update Platform Agent schema: ` + res)
 		}
 		fmt.Println("Updated DB Schema: Agent... OK")
 	}()
@@ -253,7 +270,7 @@ func updateTestDBSchema() {
 
 // teardownTestDB reroutes the standard LEAF dev environment back to the original configuration
 func teardownTestDB() {
-	db, err := sql.Open("mysql", mysqlDSN)
+	db, err := sql.Open(dbDriver, mysqlDSN)
 	if err != nil {
 		log.Fatal("Can't connect to database: ", err.Error())
 	}
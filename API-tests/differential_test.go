@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Differential testing sends the same read-only requests to two portals
+// holding identical fixture data, such as the current release and a sprint
+// candidate, and reports every structural and value difference between the
+// normalized responses. The requests are the form queries the suite makes,
+// collected with -diff.collect, plus the report builder catalog in
+// testdata/differential/report_queries.json.
+//
+//	go test -diff.collect
+//	go test -run=TestDifferential -diff.base=https://host/Test_Request_Portal/ -diff.candidate=https://host/Candidate_Portal/
+var diffBase = flag.String("diff.base", "", "portal URL used as the baseline for differential testing, defaults to RootURL")
+var diffCandidate = flag.String("diff.candidate", "", "portal URL compared with -diff.base")
+var diffCollect = flag.Bool("diff.collect", false, "save the suite's form queries to testdata/differential/suite_queries.json")
+var diffOut = flag.String("diff.out", "", "also write the differential report to this file")
+
+// diffMaxListed caps the differences listed per request
+const diffMaxListed = 20
+
+var diffCatalogs = []string{
+	filepath.Join("testdata", "differential", "suite_queries.json"),
+	filepath.Join("testdata", "differential", "report_queries.json"),
+}
+
+// diffRequest is a GET relative to the portal's root. Q is the form/query
+// q parameter, kept as JSON so catalogs stay readable.
+type diffRequest struct {
+	Name   string            `json:"name"`
+	Path   string            `json:"path"`
+	Q      json.RawMessage   `json:"q,omitempty"`
+	Params map[string]string `json:"params,omitempty"`
+}
+
+func (r diffRequest) url() (string, error) {
+	params := url.Values{}
+	for k, v := range r.Params {
+		params.Set(k, v)
+	}
+	if len(r.Q) > 0 {
+		var q bytes.Buffer
+		if err := json.Compact(&q, r.Q); err != nil {
+			return "", err
+		}
+		params.Set("q", q.String())
+	}
+	if len(params) == 0 {
+		return r.Path, nil
+	}
+
+	sep := "?"
+	if strings.Contains(r.Path, "?") {
+		sep = "&"
+	}
+	return r.Path + sep + params.Encode(), nil
+}
+
+// diffCollectSkip names the tests whose form queries aren't collected: they
+// send generated or hostile queries, not ones the suite relies on
+var diffCollectSkip = []string{
+	"TestFormQuery_GrammarFuzz",
+	"TestSQLInjection_Probes",
+}
+
+// diffCollected holds the suite's form queries in the order they were first made
+var diffCollected []diffRequest
+var diffCollectedPaths = map[string]bool{}
+var mxDiffCollected sync.Mutex
+
+// collectDiffRequest is a trafficObserver
+func collectDiffRequest(ex *exchange) {
+	path, ok := strings.CutPrefix(ex.Request.URL.String(), RootURL)
+	if ex.Request.Method != "GET" || !ok || !strings.HasPrefix(path, "api/form/query") {
+		return
+	}
+	if slices.Contains(diffCollectSkip, runningTest) {
+		return
+	}
+	path = redactCSRFToken(path)
+
+	mxDiffCollected.Lock()
+	defer mxDiffCollected.Unlock()
+
+	if diffCollectedPaths[path] {
+		return
+	}
+	diffCollectedPaths[path] = true
+	diffCollected = append(diffCollected, diffRequest{Name: runningTest, Path: path})
+}
+
+// writeDiffCollected is called by TestMain after the run
+func writeDiffCollected() error {
+	mxDiffCollected.Lock()
+	defer mxDiffCollected.Unlock()
+
+	b, err := json.MarshalIndent(diffCollected, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(diffCatalogs[0]), 0775); err != nil {
+		return err
+	}
+	return os.WriteFile(diffCatalogs[0], append(b, '\n'), 0664)
+}
+
+func loadDiffCatalog(path string) ([]diffRequest, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var requests []diffRequest
+	if err := json.Unmarshal(b, &requests); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return requests, nil
+}
+
+// diffResponse is a fetched and normalized response
+type diffResponse struct {
+	status int
+	body   any // normalized JSON, or the raw text when the response isn't JSON
+}
+
+func fetchForDiff(rawURL string) (diffResponse, error) {
+	res, err := client.Get(rawURL)
+	if err != nil {
+		return diffResponse{}, err
+	}
+	defer res.Body.Close()
+
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return diffResponse{}, err
+	}
+
+	out := diffResponse{status: res.StatusCode, body: redactCSRFToken(string(b))}
+	if normalized, err := normalizeGolden(string(b)); err == nil {
+		d := json.NewDecoder(strings.NewReader(normalized))
+		d.UseNumber()
+		var v any
+		if d.Decode(&v) == nil {
+			out.body = v
+		}
+	}
+	return out, nil
+}
+
+// difference is one change between the baseline and the candidate.
+// Structural changes are added, removed or retyped values.
+type difference struct {
+	path       string
+	structural bool
+	detail     string
+}
+
+// diffValues walks both values and appends their differences
+func diffValues(path string, base any, candidate any, diffs []difference) []difference {
+	if jsonType(base) != jsonType(candidate) {
+		return append(diffs, difference{path, true, fmt.Sprintf("type changed from %s to %s", jsonType(base), jsonType(candidate))})
+	}
+
+	switch b := base.(type) {
+	case map[string]any:
+		c := candidate.(map[string]any)
+		keys := make([]string, 0, len(b)+len(c))
+		for k := range b {
+			keys = append(keys, k)
+		}
+		for k := range c {
+			if _, exists := b[k]; !exists {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			bv, inBase := b[k]
+			cv, inCandidate := c[k]
+			switch {
+			case !inCandidate:
+				diffs = append(diffs, difference{path + "." + k, true, "removed"})
+			case !inBase:
+				diffs = append(diffs, difference{path + "." + k, true, "added"})
+			default:
+				diffs = diffValues(path+"."+k, bv, cv, diffs)
+			}
+		}
+	case []any:
+		c := candidate.([]any)
+		if len(b) != len(c) {
+			diffs = append(diffs, difference{path, true, fmt.Sprintf("length changed from %d to %d", len(b), len(c))})
+		}
+		for i := 0; i < min(len(b), len(c)); i++ {
+			diffs = diffValues(path+"["+strconv.Itoa(i)+"]", b[i], c[i], diffs)
+		}
+	default:
+		if fmt.Sprint(base) != fmt.Sprint(candidate) {
+			diffs = append(diffs, difference{path, false, fmt.Sprintf("%s -> %s", diffValueString(base), diffValueString(candidate))})
+		}
+	}
+	return diffs
+}
+
+func jsonType(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case bool:
+		return "boolean"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func diffValueString(v any) string {
+	if s, ok := v.(string); ok {
+		return strconv.Quote(truncateString(s, 80))
+	}
+	return fmt.Sprint(v)
+}
+
+// TestDifferential compares -diff.base and -diff.candidate. It's skipped unless -diff.candidate is set.
+func TestDifferential(t *testing.T) {
+	if *diffCandidate == "" {
+		t.Skip("set -diff.candidate to compare two portals")
+	}
+	base := *diffBase
+	if base == "" {
+		base = RootURL
+	}
+
+	var requests []diffRequest
+	for _, path := range diffCatalogs {
+		catalog, err := loadDiffCatalog(path)
+		if os.IsNotExist(err) {
+			t.Logf("%s does not exist. Run the suite with -diff.collect to create it.", path)
+			continue
+		} else if err != nil {
+			t.Fatalf("Could not load %s: %v", path, err)
+		}
+		requests = append(requests, catalog...)
+	}
+
+	var report strings.Builder
+	fmt.Fprintf(&report, "Differential: %s (base) vs %s (candidate)\n", base, *diffCandidate)
+	changed := 0
+	for _, r := range requests {
+		path, err := r.url()
+		if err != nil {
+			t.Errorf("%s: invalid q: %v", r.Name, err)
+			continue
+		}
+
+		baseRes, err := fetchForDiff(base + path)
+		if err != nil {
+			t.Errorf("%s: base request failed: %v", r.Name, err)
+			continue
+		}
+		candidateRes, err := fetchForDiff(*diffCandidate + path)
+		if err != nil {
+			t.Errorf("%s: candidate request failed: %v", r.Name, err)
+			continue
+		}
+
+		var diffs []difference
+		if baseRes.status != candidateRes.status {
+			diffs = append(diffs, difference{"status", false, fmt.Sprintf("%d -> %d", baseRes.status, candidateRes.status)})
+		}
+		diffs = diffValues("$", baseRes.body, candidateRes.body, diffs)
+		if len(diffs) == 0 {
+			continue
+		}
+		changed++
+
+		structural := 0
+		for _, d := range diffs {
+			if d.structural {
+				structural++
+			}
+		}
+		fmt.Fprintf(&report, "\n%s\n    GET %s\n    %d structural, %d value difference(s)\n", r.Name, truncateString(path, 200), structural, len(diffs)-structural)
+		for i, d := range diffs {
+			if i == diffMaxListed {
+				fmt.Fprintf(&report, "    ... %d more\n", len(diffs)-diffMaxListed)
+				break
+			}
+			kind := "value"
+			if d.structural {
+				kind = "structure"
+			}
+			fmt.Fprintf(&report, "    %-9s %s: %s\n", kind, d.path, d.detail)
+		}
+		t.Errorf("%s: %d structural, %d value difference(s) between base and candidate", r.Name, structural, len(diffs)-structural)
+	}
+	fmt.Fprintf(&report, "\n%d of %d request(s) differ\n", changed, len(requests))
+
+	t.Log("\n" + report.String())
+	if *diffOut != "" {
+		if err := os.WriteFile(*diffOut, []byte(report.String()), 0664); err != nil {
+			t.Errorf("Could not write %s: %v", *diffOut, err)
+		}
+	}
+}
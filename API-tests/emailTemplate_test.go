@@ -54,7 +54,7 @@ func TestEmailTemplatesPost(t *testing.T) {
 	   b, _ := io.ReadAll(res.Body)
 	   var EmailTemplate EmailTemplateResponse
 
-	   err = json.Unmarshal(b, &EmailTemplate)
+	   err = decodeJSON(RootURL+`api/emailTemplates/_LEAF_notify_next_body.tpl`, b, &EmailTemplate)
 	   t.Log(EmailTemplate)
 
 	   	if err != nil {
@@ -95,7 +95,7 @@ func TestEmailTemplatesPost(t *testing.T) {
 
 	   var EmailTemplateDel EmailTemplateResponse
 
-	   err = json.Unmarshal(b, &EmailTemplate)
+	   err = decodeJSON(RootURL+`api/emailTemplates/_LEAF_notify_next_body.tpl`, b, &EmailTemplate)
 	   t.Log(EmailTemplateDel)
 
 	   	if err != nil {
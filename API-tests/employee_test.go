@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"io"
 	"log"
@@ -19,7 +18,7 @@ func getEmployee(url string) (EmployeeResponse, error) {
 	b, _ := io.ReadAll(res.Body)
 
 	var m EmployeeResponse
-	err := json.Unmarshal(b, &m)
+	err := decodeJSON(url, b, &m)
 	if err != nil {
 		return nil, err
 	}
@@ -51,7 +50,7 @@ func postEmployee(postUrl string, data Employee) (string, error) {
 	bodyBytes, _ := io.ReadAll(res.Body)
 
 	var c string
-	err = json.Unmarshal(bodyBytes, &c)
+	err = decodeJSON(postUrl, bodyBytes, &c)
 	if err != nil {
 		log.Printf("JSON parsing error, couldn't parse: %v", string(bodyBytes))
 	}
@@ -90,7 +89,7 @@ func DisableEmployee(postUrl string) error {
 	defer resp.Body.Close()
 
 	var c string
-	err = json.Unmarshal(bodyBytes, &c)
+	err = decodeJSON(postUrl, bodyBytes, &c)
 	if err != nil {
 		log.Printf("JSON parsing error, couldn't parse: %v", string(bodyBytes))
 	}
@@ -217,7 +216,6 @@ func TestEmployee_AvoidPhantomIncrements(t *testing.T) {
 }
 
 func TestEmployee_CheckNationalEmployee(t *testing.T) {
-
 	// make sure the users are in place before we start.
 	m := Employee{
 		FirstName: "test",
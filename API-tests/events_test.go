@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/json"
 	"io"
 	"net/url"
 	"testing"
@@ -14,7 +13,7 @@ func getEvent(url string) (WorkflowEventsResponse, error) {
 	b, _ := io.ReadAll(res.Body)
 
 	var ev WorkflowEventsResponse
-	err := json.Unmarshal(b, &ev)
+	err := decodeJSON(url, b, &ev)
 	if err != nil {
 		return nil, err
 	}
@@ -47,7 +46,7 @@ func getEmailTemplatesResponse(url string) (EmailTemplatesResponse, error) {
 	b, _ := io.ReadAll(res.Body)
 
 	var emailTemplatesResponse EmailTemplatesResponse
-	err := json.Unmarshal(b, &emailTemplatesResponse)
+	err := decodeJSON(url, b, &emailTemplatesResponse)
 	if err != nil {
 		return nil, err
 	}
@@ -65,3 +65,27 @@ type UnfilledDependency struct {
 	ApproverName string `json:"approverName"`
 	ApproverUID  string `json:"approverUID"`
 }
+
+// FormQuery is the q parameter of api/form/query. Limit, LimitOffset and Match
+// are untyped so malformed queries can be built from the same model.
+type FormQuery struct {
+	Terms       []FormQueryTerm `json:"terms"`
+	Joins       []string        `json:"joins"`
+	Sort        FormQuerySort   `json:"sort"`
+	Limit       any             `json:"limit,omitempty"`
+	LimitOffset any             `json:"limitOffset,omitempty"`
+	GetData     []string        `json:"getData,omitempty"`
+}
+
+type FormQueryTerm struct {
+	ID          string `json:"id"`
+	IndicatorID string `json:"indicatorID,omitempty"`
+	Operator    string `json:"operator"`
+	Match       any    `json:"match"`
+	Gate        string `json:"gate"`
+}
+
+type FormQuerySort struct {
+	Column    string `json:"column,omitempty"`
+	Direction string `json:"direction,omitempty"`
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -22,14 +21,17 @@ func getFormQuery(url string) (FormQueryResponse, error) {
 	b, _ := io.ReadAll(res.Body)
 
 	var m FormQueryResponse
-	err := json.Unmarshal(b, &m)
+	err := decodeJSON(url, b, &m)
 
 	return m, err
 }
 
 func TestPendingGroupDesignatedNames(t *testing.T) {
 	xFilter := `recordID,categoryIDs,categoryNames,date,title,service,submitted,priority,stepID,blockingStepID,lastStatus,stepTitle,action_history.time,unfilledDependencyData`
-	res, _ := getFormQuery(RootURL + `api/form/query?q={"terms":[{"id":"stepID","operator":"=","match":"actionable","gate":"AND"},{"id":"deleted","operator":"=","match":0,"gate":"AND"}],"joins":["service","categoryName","status","unfilledDependencies"],"sort":{},"limit":10000,"limitOffset":0}&x-filterData=` + xFilter)
+	var res FormQueryResponse
+	assertQueryBudget(t, "PendingGroupDesignatedNames", func() {
+		res, _ = getFormQuery(RootURL + `api/form/query?q={"terms":[{"id":"stepID","operator":"=","match":"actionable","gate":"AND"},{"id":"deleted","operator":"=","match":0,"gate":"AND"}],"joins":["service","categoryName","status","unfilledDependencies"],"sort":{},"limit":10000,"limitOffset":0}&x-filterData=` + xFilter)
+	})
 
 	rec581 := res[581].UnfilledDependencyData
 	rec690 := res[690].UnfilledDependencyData
@@ -187,7 +189,12 @@ func TestFormQuery_GroupClickedApprove(t *testing.T) {
 func TestFormQuery_FilterActionHistory(t *testing.T) {
 	q := `api/form/query/?q={"terms":[{"id":"recordID","operator":"=","match":"9","gate":"AND"},{"id":"deleted","operator":"=","match":0,"gate":"AND"}],"joins":["action_history"],"sort":{},"limit":10000,"limitOffset":0}`
 	xFilter := `&x-filterData=recordID,title,action_history.time,action_history.description,action_history.actionTextPasttense,action_history.approverName,action_history.userMetadata`
-	res, _ := getFormQuery(RootURL + q + xFilter)
+	body, _ := httpGet(RootURL + q + xFilter)
+	var res FormQueryResponse
+	if err := decodeJSON(RootURL+q+xFilter, []byte(body), &res); err != nil {
+		t.Error(err)
+	}
+	assertGolden(t, "FormQuery_FilterActionHistory", body)
 
 	if res[9].ActionHistory[0].RecordID != 0 {
 		t.Errorf(`Record ID should not exist since it wasn't requested within action_history. want = action_history[0].recordID is null`)
@@ -286,23 +293,26 @@ func TestFormQuery_Employee_Format__Orgchart_Has_Expected_Values(t *testing.T) {
 		t.Errorf("Error posting orgchart entry.  Admin did not have access got = %v, want = %v", got, want)
 	}
 
-	formRes, _ := getFormQuery(RootURL + `api/form/query/?q={"terms":[{"id":"categoryID","operator":"=","match":"form_5ea07","gate":"AND"},{"id":"deleted","operator":"=","match":0,"gate":"AND"}],"joins":[],"sort":{},"getData":["8"],"limit":10000,"limitOffset":0}&x-filterData=recordID,title`)
-	if _, exists := formRes[11]; !exists {
-		t.Errorf("Record 11 should be readable")
+	q := RootURL + `api/form/query/?q={"terms":[{"id":"categoryID","operator":"=","match":"form_5ea07","gate":"AND"},{"id":"deleted","operator":"=","match":0,"gate":"AND"}],"joins":[],"sort":{},"getData":["8"],"limit":10000,"limitOffset":0}&x-filterData=recordID,title`
+	body, _ := httpGet(q)
+	var orgchartRes map[int]struct {
+		S1 struct {
+			Orgchart FormQuery_Orgchart_Employee `json:"id8_orgchart"`
+		} `json:"s1"`
 	}
-
-	recData := formRes[11].S1
-
-	dataInterface := recData["id8_orgchart"]
-	orgchart := dataInterface.(map[string]interface{})
-	b, _ := json.Marshal(orgchart)
-
-	var org_emp FormQuery_Orgchart_Employee
-	err = json.Unmarshal(b, &org_emp)
+	err = decodeJSON(q, []byte(body), &orgchartRes)
 	if err != nil {
 		t.Error("Error on FormQuery_Orgchart_Employee unmarshal")
 	}
 
+	// getFormQuery decodes last, so the route keeps FormQueryResponse as its response type
+	formRes, _ := getFormQuery(q)
+	if _, exists := formRes[11]; !exists {
+		t.Errorf("Record 11 should be readable")
+	}
+
+	org_emp := orgchartRes[11].S1.Orgchart
+
 	got = org_emp.FirstName
 	want = mock_orgchart_employee.FirstName
 	if !cmp.Equal(got, want) {
@@ -515,13 +525,12 @@ func TestFormQuery_Records_UserMetadata__Has_Expected_Values(t *testing.T) {
 }
 
 func TestForm_VerifyInitiator(t *testing.T) {
-
 	url := RootURL + `api/form/query/?q={"terms":[{"id":"recordID","operator":"=","match":"5","gate":"AND"},{"id":"deleted","operator":"=","match":0,"gate":"AND"}],"joins":["initiatorName"],"sort":{}}&x-filterData=recordID,lastName,firstName,userName`
 	res, _ := client.Get(url)
 	b, _ := io.ReadAll(res.Body)
 
 	var formQueryResponse FormQueryResponse
-	err := json.Unmarshal(b, &formQueryResponse)
+	err := decodeJSON(url, b, &formQueryResponse)
 	if err != nil {
 		t.Error(err)
 	}
@@ -541,7 +550,6 @@ func TestForm_VerifyInitiator(t *testing.T) {
 
 /* Test special characters saved in the title of a record and contents of a record */
 func TestFormQuery_Special_Characters(t *testing.T) {
-
 	theTestString := "This is an otter 🦦 this is a smiley 😀"
 	theTestTitleString := "TestForm_Special_Characters😀"
 
@@ -558,7 +566,7 @@ func TestFormQuery_Special_Characters(t *testing.T) {
 	pRes, _ := client.PostForm(RootURL+`api/form/new`, postData)
 	bodyBytes, _ := io.ReadAll(pRes.Body)
 	var response string
-	json.Unmarshal(bodyBytes, &response)
+	decodeJSON(RootURL+`api/form/new`, bodyBytes, &response)
 	recordID, err := strconv.Atoi(string(response))
 
 	if err != nil {
@@ -666,13 +674,12 @@ func TestFormQuery_RoleBasedInbox_PersonDesginatedAndFollowup(t *testing.T) {
 
 // Report Builder Step 2: Enable Current Status
 func TestForm_QueryJoinStatus(t *testing.T) {
-
 	url := RootURL + `api/form/query?q={"terms":[{"id":"stepID","operator":"!=","match":"resolved","gate":"AND"},{"id":"deleted","operator":"=","match":0,"gate":"AND"}],"joins":["status"],"sort":{},"limit":1000,"limitOffset":0}&x-filterData=recordID,title,stepTitle,lastStatus`
 	res, _ := client.Get(url)
 	b, _ := io.ReadAll(res.Body)
 
 	var formQueryResponse FormQueryResponse
-	err := json.Unmarshal(b, &formQueryResponse)
+	err := decodeJSON(url, b, &formQueryResponse)
 	if err != nil {
 		t.Error(err)
 	}
@@ -686,6 +693,8 @@ func TestForm_QueryJoinStatus(t *testing.T) {
 }
 
 func TestLargeFormQuery_SmallQuery(t *testing.T) {
+	defer profileSQL(t)()
+
 	url := RootURL + `api/form/query/?q={"terms":[{"id":"stepID","operator":"!=","match":"resolved","gate":"AND"},{"id":"deleted","operator":"=","match":0,"gate":"AND"}],"joins":["status","initiatorName"],"sort":{},"limit":10000,"getData":["9","8","10","4","5","7","3","6","2"]}&x-filterData=recordID,title,stepTitle,lastStatus,lastName,firstName`
 
 	url = strings.Replace(url, " ", "%20", -1)
@@ -693,7 +702,7 @@ func TestLargeFormQuery_SmallQuery(t *testing.T) {
 	b, _ := io.ReadAll(res.Body)
 
 	var formQueryResponse FormQueryResponse
-	_ = json.Unmarshal(b, &formQueryResponse)
+	_ = decodeJSON(url, b, &formQueryResponse)
 
 	if _, exists := formQueryResponse[958]; !exists {
 		t.Errorf("Record 958 should be readable")
@@ -705,6 +714,8 @@ func TestLargeFormQuery_SmallQuery(t *testing.T) {
 }
 
 func TestLargeFormQuery_SmallQuery_Indi_lt10_Limit1001(t *testing.T) {
+	defer profileSQL(t)()
+
 	url := RootURL + `api/form/query/?q={"terms":[{"id":"stepID","operator":"!=","match":"resolved","gate":"AND"},{"id":"deleted","operator":"=","match":0,"gate":"AND"}],"joins":[],"sort":{},"getData":["9","8","10","4","5","7","3","6"],"limit":1001}&x-filterData=recordID,title`
 
 	url = strings.Replace(url, " ", "%20", -1)
@@ -712,7 +723,7 @@ func TestLargeFormQuery_SmallQuery_Indi_lt10_Limit1001(t *testing.T) {
 	b, _ := io.ReadAll(res.Body)
 
 	var formQueryResponse FormQueryResponse
-	_ = json.Unmarshal(b, &formQueryResponse)
+	_ = decodeJSON(url, b, &formQueryResponse)
 
 	if _, exists := formQueryResponse[958]; !exists {
 		t.Errorf("Record 958 should be readable")
@@ -724,6 +735,8 @@ func TestLargeFormQuery_SmallQuery_Indi_lt10_Limit1001(t *testing.T) {
 }
 
 func TestLargeFormQuery_LargeQuery_NoLimit(t *testing.T) {
+	defer profileSQL(t)()
+
 	url := RootURL + `api/form/query/?q={"terms":[{"id":"stepID","operator":"!=","match":"resolved","gate":"AND"},{"id":"deleted","operator":"=","match":0,"gate":"AND"}],"joins":["status","initiatorName"],"sort":{},"getData":["9","8","10","4","5","7","3","6","2"]}&x-filterData=recordID,title,stepTitle,lastStatus,lastName,firstName`
 
 	url = strings.Replace(url, " ", "%20", -1)
@@ -731,7 +744,7 @@ func TestLargeFormQuery_LargeQuery_NoLimit(t *testing.T) {
 	b, _ := io.ReadAll(res.Body)
 
 	var formQueryResponse FormQueryResponse
-	_ = json.Unmarshal(b, &formQueryResponse)
+	_ = decodeJSON(url, b, &formQueryResponse)
 
 	if _, exists := formQueryResponse[958]; !exists {
 		t.Errorf("Record 958 should be readable")
@@ -744,6 +757,8 @@ func TestLargeFormQuery_LargeQuery_NoLimit(t *testing.T) {
 }
 
 func TestLargeFormQuery_LargeQuery_LimitGT110000(t *testing.T) {
+	defer profileSQL(t)()
+
 	url := RootURL + `api/form/query/?q={"terms":[{"id":"stepID","operator":"!=","match":"resolved","gate":"AND"},{"id":"deleted","operator":"=","match":0,"gate":"AND"}],"joins":["status","initiatorName"],"sort":{},"getData":["9","8","10","4","5","7","3","6","2"],"limit":10001}&x-filterData=recordID,title,stepTitle,lastStatus,lastName,firstName`
 
 	url = strings.Replace(url, " ", "%20", -1)
@@ -751,7 +766,7 @@ func TestLargeFormQuery_LargeQuery_LimitGT110000(t *testing.T) {
 	b, _ := io.ReadAll(res.Body)
 
 	var formQueryResponse FormQueryResponse
-	_ = json.Unmarshal(b, &formQueryResponse)
+	_ = decodeJSON(url, b, &formQueryResponse)
 
 	if _, exists := formQueryResponse[958]; !exists {
 		t.Errorf("Record 958 should be readable")
@@ -764,6 +779,8 @@ func TestLargeFormQuery_LargeQuery_LimitGT110000(t *testing.T) {
 }
 
 func TestLargeFormQuery_LargeQuery_Indi_10_Limit1001(t *testing.T) {
+	defer profileSQL(t)()
+
 	url := RootURL + `api/form/query/?q={"terms":[{"id":"stepID","operator":"!=","match":"resolved","gate":"AND"},{"id":"deleted","operator":"=","match":0,"gate":"AND"}],"joins":[],"sort":{},"getData":["9","8","10","4","5","7","3","6","2","-7","-5","-6","-2","-1","-4","14","15","12","1"],"limit":1001}&x-filterData=recordID,title`
 
 	url = strings.Replace(url, " ", "%20", -1)
@@ -771,7 +788,7 @@ func TestLargeFormQuery_LargeQuery_Indi_10_Limit1001(t *testing.T) {
 	b, _ := io.ReadAll(res.Body)
 
 	var formQueryResponse FormQueryResponse
-	_ = json.Unmarshal(b, &formQueryResponse)
+	_ = decodeJSON(url, b, &formQueryResponse)
 
 	if _, exists := formQueryResponse[958]; !exists {
 		t.Errorf("Record 958 should be readable")
@@ -786,7 +803,7 @@ func TestLargeFormQuery_LargeQuery_Indi_10_Limit1001(t *testing.T) {
 func TestValidAuthorizationToken(t *testing.T) {
 	cookieJar, _ := cookiejar.New(nil)
 	client := &http.Client{
-		Transport: tr,
+		Transport: suiteTransport,
 		Timeout:   time.Second * 5,
 		Jar:       cookieJar,
 	}
@@ -801,7 +818,7 @@ func TestValidAuthorizationToken(t *testing.T) {
 	}
 	b, _ := io.ReadAll(res.Body)
 	var formRes FormQueryResponse
-	err = json.Unmarshal(b, &formRes)
+	err = decodeJSON(req.URL.String(), b, &formRes)
 	if err != nil {
 		t.Error(err, string(b))
 	}
@@ -814,7 +831,7 @@ func TestValidAuthorizationToken(t *testing.T) {
 func TestInvalidAuthorizationToken(t *testing.T) {
 	cookieJar, _ := cookiejar.New(nil)
 	client := &http.Client{
-		Transport: tr,
+		Transport: suiteTransport,
 		Timeout:   time.Second * 5,
 		Jar:       cookieJar,
 	}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/json"
 	"io"
 	"log"
 	"net/url"
@@ -30,7 +29,7 @@ func postNewForm() string {
 	bodyBytes, _ := io.ReadAll(res.Body)
 
 	var c string
-	err := json.Unmarshal(bodyBytes, &c)
+	err := decodeJSON(RootURL+`api/formEditor/new`, bodyBytes, &c)
 	if err != nil {
 		log.Printf("JSON parsing error, couldn't parse: %v", string(bodyBytes))
 	}
@@ -46,7 +45,7 @@ func postUpdateQuestion(indicator string, field string, format string) string {
 	bodyBytes, _ := io.ReadAll(res.Body)
 
 	var c string
-	err := json.Unmarshal(bodyBytes, &c)
+	err := decodeJSON(RootURL+`api/formEditor/`+indicator+`/`+field, bodyBytes, &c)
 	if err != nil {
 		log.Printf("JSON parsing error, couldn't parse: %v", string(c))
 	}
@@ -59,7 +58,7 @@ func getFormStack(url string) FormStackResponse {
 	b, _ := io.ReadAll(res.Body)
 
 	var m FormStackResponse
-	err := json.Unmarshal(b, &m)
+	err := decodeJSON(url, b, &m)
 	if err != nil {
 		log.Printf("JSON parsing error, couldn't parse: %v", string(b))
 		log.Printf("JSON parsing error: %v", err.Error())
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/json"
 	"io"
 	"log"
 	"net/http"
@@ -16,7 +15,7 @@ func getFormWorkflow(url string) FormWorkflowResponse {
 	b, _ := io.ReadAll(res.Body)
 
 	var m FormWorkflowResponse
-	err := json.Unmarshal(b, &m)
+	err := decodeJSON(url, b, &m)
 	if err != nil {
 		log.Printf("JSON parsing error, couldn't parse: %v", string(b))
 		log.Printf("JSON parsing error: %v", err.Error())
@@ -157,7 +156,6 @@ func TestFormWorkflow_currentStepRequestorFollowupNonAdmin(t *testing.T) {
 }
 
 func TestFormWorkflow_ChangeStepDifferentWorkflow(t *testing.T) {
-
 	// Move record 17 to step 7, which is in a different workflow
 	postData := url.Values{}
 	postData.Set("CSRFToken", CsrfToken)
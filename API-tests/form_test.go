@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/json"
 	"io"
 	"net/url"
 	"strconv"
@@ -123,7 +122,7 @@ func TestForm_IsMaskable(t *testing.T) {
 	res, _ := httpGet(RootURL + "api/form/_form_ce46b")
 
 	var m FormCategoryResponse
-	err := json.Unmarshal([]byte(res), &m)
+	err := decodeJSON(RootURL+"api/form/_form_ce46b", []byte(res), &m)
 	if err != nil {
 		t.Error(err)
 	}
@@ -131,10 +130,11 @@ func TestForm_IsMaskable(t *testing.T) {
 	if m[0].IsMaskable != nil {
 		t.Errorf("./api/form/_form_ce46b isMaskable = %v, want = %v", m[0].IsMaskable, nil)
 	}
+	assertGolden(t, "Form_IsMaskable", res)
 
 	res, _ = httpGet(RootURL + "api/form/_form_ce46b?context=formEditor")
 
-	err = json.Unmarshal([]byte(res), &m)
+	err = decodeJSON(RootURL+"api/form/_form_ce46b?context=formEditor", []byte(res), &m)
 	if err != nil {
 		t.Error(err)
 	}
@@ -142,6 +142,7 @@ func TestForm_IsMaskable(t *testing.T) {
 	if *m[0].IsMaskable != 0 {
 		t.Errorf("./api/form/_form_ce46b?context=formEditor isMaskable = %v, want = %v", m[0].IsMaskable, "0")
 	}
+	assertGolden(t, "Form_IsMaskable_formEditor", res)
 }
 
 func TestForm_NonadminCannotCancelOwnSubmittedRecord(t *testing.T) {
@@ -157,7 +158,7 @@ func TestForm_NonadminCannotCancelOwnSubmittedRecord(t *testing.T) {
 	res, _ := client.PostForm(RootURL+`api/form/new`, postData)
 	bodyBytes, _ := io.ReadAll(res.Body)
 	var response string
-	json.Unmarshal(bodyBytes, &response)
+	decodeJSON(RootURL+`api/form/new`, bodyBytes, &response)
 	recordID, err := strconv.Atoi(string(response))
 
 	if err != nil {
@@ -174,7 +175,7 @@ func TestForm_NonadminCannotCancelOwnSubmittedRecord(t *testing.T) {
 
 	res, _ = client.PostForm(RootURL+`api/form/`+strconv.Itoa(recordID)+`/cancel?masquerade=nonAdmin`, postData)
 	bodyBytes, _ = io.ReadAll(res.Body)
-	json.Unmarshal(bodyBytes, &response)
+	decodeJSON(RootURL+`api/form/`+strconv.Itoa(recordID)+`/cancel`, bodyBytes, &response)
 	got := response
 
 	if got == "1" {
@@ -186,7 +187,7 @@ func TestForm_FilterChildkeys(t *testing.T) {
 	res, _ := httpGet(RootURL + "api/form/9/data/tree?x-filterData=child.name")
 
 	var m FormCategoryResponse
-	err := json.Unmarshal([]byte(res), &m)
+	err := decodeJSON(RootURL+"api/form/9/data/tree", []byte(res), &m)
 	if err != nil {
 		t.Error(err)
 	}
@@ -219,7 +220,7 @@ func TestForm_GetProgress_ReturnValue(t *testing.T) {
 	res, _ := client.PostForm(RootURL+`api/form/new`, postData)
 	bodyBytes, _ := io.ReadAll(res.Body)
 	var response string
-	json.Unmarshal(bodyBytes, &response)
+	decodeJSON(RootURL+`api/form/new`, bodyBytes, &response)
 	recordID := string(response)
 
 	urlGetProgress := RootURL + "api/form/" + recordID + "/progress"
@@ -528,7 +529,7 @@ func TestForm_DuplicateIndicatorsInIndicatorListWithFormFilter(t *testing.T) {
 	res, _ := httpGet(RootURL + "api/form/indicator/list?includeHeadings=1&forms=form_2ca98,form_5ea07,form_7664a,form_512fa,form_ce46b")
 	var list FormIndicatorList
 
-	err := json.Unmarshal([]byte(res), &list)
+	err := decodeJSON(RootURL+"api/form/indicator/list", []byte(res), &list)
 	if err != nil {
 		t.Error(err)
 	}
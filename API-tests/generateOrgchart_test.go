@@ -0,0 +1,193 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// Synthetic employees give employee search, service membership and the sync
+// scripts a production-sized org chart, and give workflows realistic approver
+// chains. Generation is reproducible for a given -employees and -seed:
+//
+//	go test -run="^TestEmployee_" -employees=5000 -seed=1
+var employeeCount = flag.Int("employees", 0, "number of synthetic employees to add to the Nexus test database")
+
+const (
+	// orgchartFanout is the number of direct reports per supervisor; 5000 employees are 6 levels deep
+	orgchartFanout = 4
+
+	// orgchartRootPositionID is the top of the existing hierarchy (Medical Center Director)
+	orgchartRootPositionID = 1
+
+	// Positions and groups use smallint unsigned IDs
+	orgchartMaxID = 65535
+)
+
+var generatorFirstNames = strings.Fields(`Alex Jordan Taylor Morgan Casey Riley Jamie Avery Quinn Parker Drew Cameron
+	Skyler Reese Rowan Emerson Finley Harper Kendall Logan Peyton Sawyer Hayden Blake`)
+var generatorLastNames = strings.Fields(`Smith Johnson Williams Brown Jones Garcia Miller Davis Rodriguez Martinez
+	Hernandez Lopez Wilson Anderson Thomas Moore Jackson Martin Lee Thompson White Harris Clark Lewis`)
+var generatorPositionTitles = strings.Fields(`Director Chief Manager Supervisor Lead Specialist Analyst Assistant`)
+
+// Nexus indicators written for each generated employee
+const (
+	nexusIndicatorPhone = 5
+	nexusIndicatorEmail = 6
+	nexusIndicatorRoom  = 8
+)
+
+// generateOrgchart adds n employees to the Nexus test database. Each employee
+// fills a position that reports to the position above it, positions directly
+// under the root become ELT groups, the next level down become services, and
+// some employees are given an approved backup.
+func generateOrgchart(n int, seed int64) {
+	db := getDB()
+	defer db.Close()
+
+	start := time.Now()
+	rnd := rand.New(rand.NewSource(seed))
+
+	var firstEmpUID, firstPositionID, firstGroupID int
+	err := db.QueryRow(`SELECT (SELECT COALESCE(MAX(empUID), 0) + 1 FROM `+testNexusDbName+`.employee),
+								(SELECT COALESCE(MAX(positionID), 0) + 1 FROM `+testNexusDbName+`.positions),
+								(SELECT COALESCE(MAX(groupID), 0) + 1 FROM `+testNexusDbName+`.groups)`).
+		Scan(&firstEmpUID, &firstPositionID, &firstGroupID)
+	if err != nil {
+		log.Fatal("Could not read Nexus test database: ", err.Error())
+	}
+	if firstPositionID+n > orgchartMaxID {
+		log.Fatalf("Could not generate org chart: at most %d employees fit in the positions table", orgchartMaxID-firstPositionID)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	employees := &batchInserter{tx: tx, table: testNexusDbName + ".employee",
+		columns: []string{"empUID", "userName", "lastName", "firstName", "middleName", "phoneticFirstName", "phoneticLastName", "domain", "deleted", "lastUpdated", "new_empUUID"}}
+	employeeData := &batchInserter{tx: tx, table: testNexusDbName + ".employee_data",
+		columns: []string{"empUID", "indicatorID", "data", "author", "timestamp"}}
+	positions := &batchInserter{tx: tx, table: testNexusDbName + ".positions",
+		columns: []string{"positionID", "parentID", "positionTitle", "phoneticPositionTitle", "numberFTE"}}
+	positionEmployees := &batchInserter{tx: tx, table: testNexusDbName + ".relation_position_employee", parent: positions,
+		columns: []string{"positionID", "empUID", "isActing"}}
+	groups := &batchInserter{tx: tx, table: testNexusDbName + ".groups",
+		columns: []string{"groupID", "parentID", "groupTitle", "groupAbbreviation", "phoneticGroupTitle"}}
+	groupTags := &batchInserter{tx: tx, table: testNexusDbName + ".group_tags", parent: groups,
+		columns: []string{"groupID", "tag"}}
+	groupPositions := &batchInserter{tx: tx, table: testNexusDbName + ".relation_group_position", parent: groups,
+		columns: []string{"groupID", "positionID"}}
+	groupEmployees := &batchInserter{tx: tx, table: testNexusDbName + ".relation_group_employee", parent: groups,
+		columns: []string{"groupID", "empUID"}}
+	backups := &batchInserter{tx: tx, table: testNexusDbName + ".relation_employee_backup",
+		columns: []string{"empUID", "backupEmpUID", "approved", "approverUserName"}}
+
+	// groupOf[i] is the group employee i belongs to: its ELT group, or its service once it's below one
+	groupOf := make([]int, n)
+	nextGroupID := firstGroupID
+	var eltCount, serviceCount int
+
+	for i := 0; i < n; i++ {
+		empUID := firstEmpUID + i
+		positionID := firstPositionID + i
+
+		// Breadth-first tree: the first fanout employees report to the root position,
+		// after that employee i reports to employee i/fanout-1
+		parentIndex := -1
+		parentPositionID := orgchartRootPositionID
+		level := 1
+		if i >= orgchartFanout {
+			parentIndex = i/orgchartFanout - 1
+			parentPositionID = firstPositionID + parentIndex
+			for j := i; j >= orgchartFanout; j = j/orgchartFanout - 1 {
+				level++
+			}
+		}
+
+		first := generatorFirstNames[rnd.Intn(len(generatorFirstNames))]
+		middle := generatorFirstNames[rnd.Intn(len(generatorFirstNames))]
+		last := generatorLastNames[rnd.Intn(len(generatorLastNames))]
+		userName := fmt.Sprintf("VTRSYN%s%s%d", strings.ToUpper(first[:3]), strings.ToUpper(last[:3]), empUID)
+		domain := fmt.Sprintf("VTR-%d", 1000+rnd.Intn(9000))
+
+		employees.add(empUID, userName, last, first, middle, phonetic(first), phonetic(last), domain, 0, generatedRecordsEpoch, generatorUUID(rnd))
+		employeeData.add(empUID, nexusIndicatorPhone, fmt.Sprintf("555-555-%04d", rnd.Intn(10000)), "system", generatedRecordsEpoch)
+		employeeData.add(empUID, nexusIndicatorEmail, first+"."+last+fmt.Sprint(empUID)+"@fake-email.com", "system", generatedRecordsEpoch)
+		employeeData.add(empUID, nexusIndicatorRoom, fmt.Sprintf("Building %d, Room %d", 1+rnd.Intn(20), 100+rnd.Intn(400)), "system", generatedRecordsEpoch)
+
+		title := generatorPositionTitles[min(level-1, len(generatorPositionTitles)-1)] + " " + fmt.Sprint(positionID)
+		positions.add(positionID, parentPositionID, title, strings.ToUpper(phonetic(title)), 1)
+		positionEmployees.add(positionID, empUID, 0)
+
+		switch {
+		case level == 1 && nextGroupID <= orgchartMaxID:
+			groupOf[i] = nextGroupID
+			groups.add(nextGroupID, 0, "Synthetic ELT "+fmt.Sprint(positionID), nil, strings.ToUpper(phonetic("Synthetic ELT")))
+			groupTags.add(nextGroupID, "ELT")
+			groupPositions.add(nextGroupID, positionID)
+			nextGroupID++
+			eltCount++
+		case level == 2 && nextGroupID <= orgchartMaxID:
+			groupOf[i] = nextGroupID
+			groups.add(nextGroupID, groupOf[parentIndex], "Synthetic Service "+fmt.Sprint(positionID), fmt.Sprintf("SYN%d", positionID), strings.ToUpper(phonetic("Synthetic Service")))
+			groupTags.add(nextGroupID, "service")
+			groupPositions.add(nextGroupID, positionID)
+			nextGroupID++
+			serviceCount++
+		case parentIndex >= 0:
+			groupOf[i] = groupOf[parentIndex]
+		}
+		if groupOf[i] > 0 {
+			groupEmployees.add(groupOf[i], empUID)
+		}
+
+		// About 1 in 5 employees has a coworker with the same supervisor as their backup
+		if i > 0 && rnd.Intn(5) == 0 && (i-1)/orgchartFanout == i/orgchartFanout {
+			backups.add(empUID, empUID-1, 1, "tester")
+		}
+	}
+
+	for _, b := range []*batchInserter{employees, employeeData, positions, positionEmployees, groups, groupTags, groupPositions, groupEmployees, backups} {
+		b.flush()
+	}
+	if err := tx.Commit(); err != nil {
+		log.Fatal("Could not commit generated org chart: ", err.Error())
+	}
+
+	// Bring the new services into the portal
+	if err := syncServices(RootURL + `scripts/sync_services.php`); err != nil {
+		log.Fatal("Could not sync services: ", err.Error())
+	}
+
+	fmt.Printf("Generated %d employees, %d ELT groups and %d services (seed %d) in %v\n",
+		n, eltCount, serviceCount, seed, time.Since(start).Round(time.Millisecond))
+}
+
+// phonetic approximates the fixtures' phonetic columns: lowercase, without vowels after the first letter
+func phonetic(s string) string {
+	var sb strings.Builder
+	for i, r := range strings.ToLower(s) {
+		if r < 'a' || r > 'z' {
+			continue
+		}
+		if i > 0 && strings.ContainsRune("aeiou", r) {
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// generatorUUID returns a version 4 UUID drawn from rnd, so it's stable for a given seed
+func generatorUUID(rnd *rand.Rand) string {
+	b := make([]byte, 16)
+	rnd.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Synthetic records let the TestLargeFormQuery_* tests and benchmarks run
+// against production-sized portals. The same -records and -seed always produce
+// the same database, so results can be compared between releases:
+//
+//	go test -run="^$" -bench=. -records=100000 -seed=1
+var recordCount = flag.Int("records", 0, "number of synthetic records to add to the portal test database")
+var recordSeed = flag.Int64("seed", 1, "random seed used by the synthetic data generators")
+
+// generatedRecordsEpoch anchors generated timestamps, so output doesn't depend on when the generator ran
+const generatedRecordsEpoch = 1704067200 // 2024-01-01 00:00:00 UTC
+
+const generatorBatchSize = 1000
+
+var generatorWords = strings.Fields(`apple pear orange budget travel equipment laptop monitor training
+	conference renewal contract facility repair vehicle request approval review urgent routine annual
+	quarterly staff support network printer office supplies software license access badge parking`)
+
+// batchInserter accumulates rows and writes them as multi-row INSERT statements.
+// If parent is set, it's flushed first so foreign keys are satisfied.
+type batchInserter struct {
+	tx      *sql.Tx
+	table   string
+	columns []string
+	rows    [][]any
+	parent  *batchInserter
+}
+
+func (b *batchInserter) add(values ...any) {
+	b.rows = append(b.rows, values)
+	if len(b.rows) >= generatorBatchSize {
+		b.flush()
+	}
+}
+
+func (b *batchInserter) flush() {
+	if len(b.rows) == 0 {
+		return
+	}
+	if b.parent != nil {
+		b.parent.flush()
+	}
+
+	placeholder := "(" + strings.TrimSuffix(strings.Repeat("?,", len(b.columns)), ",") + ")"
+	placeholders := make([]string, len(b.rows))
+	args := make([]any, 0, len(b.rows)*len(b.columns))
+	for i, row := range b.rows {
+		placeholders[i] = placeholder
+		args = append(args, row...)
+	}
+
+	_, err := b.tx.Exec("INSERT INTO "+b.table+" (`"+strings.Join(b.columns, "`, `")+"`) VALUES "+strings.Join(placeholders, ","), args...)
+	if err != nil {
+		log.Fatal("Could not insert into "+b.table+": ", err.Error())
+	}
+	b.rows = b.rows[:0]
+}
+
+type generatorIndicator struct {
+	indicatorID int
+	format      string
+	options     []string
+}
+
+type generatorForm struct {
+	categoryID   string
+	categoryName string
+	indicators   []generatorIndicator
+	path         []int // stepIDs in the order the workflow's approve routes visit them
+}
+
+type generatorUser struct {
+	userID       string
+	userMetadata string
+}
+
+// recordGenerator holds the portal configuration that synthetic records are drawn from
+type recordGenerator struct {
+	rnd        *rand.Rand
+	forms      []generatorForm
+	users      []generatorUser
+	services   []int
+	empUIDs    []int
+	groupIDs   []int
+	stepDepIDs map[int][]int
+}
+
+// generateRecords adds n records spread across the enabled forms in the portal
+// test database, including their data, workflow state, dependencies and action history
+func generateRecords(n int, seed int64) {
+	db := getDB()
+	defer db.Close()
+
+	start := time.Now()
+	g := recordGenerator{rnd: rand.New(rand.NewSource(seed))}
+	g.load(db)
+	if len(g.forms) == 0 || len(g.users) == 0 {
+		log.Fatal("Could not generate records: the portal test database has no forms or users to draw from")
+	}
+
+	var firstRecordID int
+	err := db.QueryRow("SELECT COALESCE(MAX(recordID), 0) + 1 FROM " + testPortalDbName + ".records").Scan(&firstRecordID)
+	if err != nil {
+		log.Fatal("Could not read records: ", err.Error())
+	}
+
+	for batchStart := 0; batchStart < n; batchStart += generatorBatchSize * 10 {
+		batchEnd := min(batchStart+generatorBatchSize*10, n)
+
+		tx, err := db.Begin()
+		if err != nil {
+			log.Fatal(err)
+		}
+		g.insertRecords(tx, firstRecordID+batchStart, batchEnd-batchStart)
+		if err := tx.Commit(); err != nil {
+			log.Fatal("Could not commit generated records: ", err.Error())
+		}
+	}
+
+	fmt.Printf("Generated %d records (seed %d) in %v\n", n, seed, time.Since(start).Round(time.Millisecond))
+}
+
+// load reads the forms, workflows, users and org chart entities that generated records refer to
+func (g *recordGenerator) load(db *sql.DB) {
+	initialSteps := map[int]int{}
+	routes := map[int]int{}
+	rows := queryRows(db, "SELECT workflowID, initialStepID FROM "+testPortalDbName+".workflows WHERE workflowID > 0")
+	for rows.Next() {
+		var workflowID, stepID int
+		rows.Scan(&workflowID, &stepID)
+		initialSteps[workflowID] = stepID
+	}
+	rows.Close()
+
+	rows = queryRows(db, "SELECT stepID, nextStepID FROM "+testPortalDbName+".workflow_routes WHERE actionType = 'approve' AND stepID > 0")
+	for rows.Next() {
+		var stepID, nextStepID int
+		rows.Scan(&stepID, &nextStepID)
+		routes[stepID] = nextStepID
+	}
+	rows.Close()
+
+	g.stepDepIDs = map[int][]int{}
+	rows = queryRows(db, "SELECT stepID, dependencyID FROM "+testPortalDbName+".step_dependencies ORDER BY stepID, dependencyID")
+	for rows.Next() {
+		var stepID, dependencyID int
+		rows.Scan(&stepID, &dependencyID)
+		g.stepDepIDs[stepID] = append(g.stepDepIDs[stepID], dependencyID)
+	}
+	rows.Close()
+
+	rows = queryRows(db, `SELECT categoryID, categoryName, workflowID FROM `+testPortalDbName+`.categories
+							WHERE parentID = '' AND disabled = 0 AND workflowID > 0
+							ORDER BY categoryID`)
+	for rows.Next() {
+		var form generatorForm
+		var workflowID int
+		rows.Scan(&form.categoryID, &form.categoryName, &workflowID)
+
+		// Follow approve routes from the initial step; stop on loops
+		visited := map[int]bool{}
+		for stepID := initialSteps[workflowID]; stepID > 0 && !visited[stepID]; stepID = routes[stepID] {
+			visited[stepID] = true
+			form.path = append(form.path, stepID)
+		}
+		g.forms = append(g.forms, form)
+	}
+	rows.Close()
+
+	for i := range g.forms {
+		rows = queryRows(db, `SELECT indicatorID, format FROM `+testPortalDbName+`.indicators
+								WHERE categoryID = ? AND disabled = 0
+								ORDER BY indicatorID`, g.forms[i].categoryID)
+		for rows.Next() {
+			var ind generatorIndicator
+			rows.Scan(&ind.indicatorID, &ind.format)
+			lines := strings.Split(strings.ReplaceAll(ind.format, "\r", ""), "\n")
+			ind.format = strings.TrimSpace(lines[0])
+			for _, opt := range lines[1:] {
+				if opt = strings.TrimSpace(opt); opt != "" {
+					ind.options = append(ind.options, opt)
+				}
+			}
+			g.forms[i].indicators = append(g.forms[i].indicators, ind)
+		}
+		rows.Close()
+	}
+
+	rows = queryRows(db, `SELECT userID, MIN(CAST(userMetadata AS CHAR)) FROM `+testPortalDbName+`.records
+							WHERE userMetadata IS NOT NULL
+							GROUP BY userID ORDER BY userID`)
+	for rows.Next() {
+		var u generatorUser
+		rows.Scan(&u.userID, &u.userMetadata)
+		g.users = append(g.users, u)
+	}
+	rows.Close()
+
+	g.services = queryInts(db, "SELECT serviceID FROM "+testPortalDbName+".services ORDER BY serviceID")
+	g.empUIDs = queryInts(db, "SELECT empUID FROM "+testNexusDbName+".employee WHERE deleted = 0 ORDER BY empUID LIMIT 5000")
+	g.groupIDs = queryInts(db, "SELECT groupID FROM "+testNexusDbName+".groups ORDER BY groupID LIMIT 5000")
+}
+
+func (g *recordGenerator) insertRecords(tx *sql.Tx, firstRecordID int, n int) {
+	records := &batchInserter{tx: tx, table: testPortalDbName + ".records",
+		columns: []string{"recordID", "date", "serviceID", "userID", "title", "priority", "lastStatus", "submitted", "deleted", "isWritableUser", "isWritableGroup", "userMetadata"}}
+	categoryCount := &batchInserter{tx: tx, table: testPortalDbName + ".category_count", parent: records,
+		columns: []string{"recordID", "categoryID", "count"}}
+	data := &batchInserter{tx: tx, table: testPortalDbName + ".data", parent: records,
+		columns: []string{"recordID", "indicatorID", "series", "data", "timestamp", "userID"}}
+	workflowState := &batchInserter{tx: tx, table: testPortalDbName + ".records_workflow_state", parent: records,
+		columns: []string{"recordID", "stepID", "blockingStepID", "lastNotified", "initialNotificationSent"}}
+	dependencies := &batchInserter{tx: tx, table: testPortalDbName + ".records_dependencies", parent: records,
+		columns: []string{"recordID", "dependencyID", "filled", "time"}}
+	actionHistory := &batchInserter{tx: tx, table: testPortalDbName + ".action_history", parent: records,
+		columns: []string{"recordID", "userID", "stepID", "dependencyID", "actionType", "actionTypeID", "time", "comment", "userMetadata"}}
+
+	for recordID := firstRecordID; recordID < firstRecordID+n; recordID++ {
+		form := g.forms[g.rnd.Intn(len(g.forms))]
+		user := g.users[g.rnd.Intn(len(g.users))]
+		created := generatedRecordsEpoch - g.rnd.Intn(2*365*24*3600)
+		serviceID := 0
+		if len(g.services) > 0 {
+			serviceID = g.services[g.rnd.Intn(len(g.services))]
+		}
+
+		// Roughly 1 in 5 records is an unsubmitted draft, and 1 in 50 is deleted
+		submitted := 0
+		if g.rnd.Intn(5) > 0 {
+			submitted = created + g.rnd.Intn(3600)
+		}
+		deleted := 0
+		if g.rnd.Intn(50) == 0 {
+			deleted = created + g.rnd.Intn(7*24*3600)
+		}
+
+		// progress is the number of steps already approved; reaching the end of the path resolves the record
+		progress := 0
+		var lastStatus any
+		if submitted > 0 {
+			progress = g.rnd.Intn(len(form.path) + 1)
+			lastStatus = "Submitted"
+			if progress == len(form.path) {
+				lastStatus = "Approved"
+			}
+		}
+
+		title := form.categoryName + " - " + g.words(3)
+		records.add(recordID, created, serviceID, user.userID, title, 0, lastStatus, submitted, deleted, 1, 1, user.userMetadata)
+		categoryCount.add(recordID, form.categoryID, 1)
+
+		for _, ind := range form.indicators {
+			if value := g.indicatorValue(ind, created); value != "" {
+				data.add(recordID, ind.indicatorID, 1, value, created, user.userID)
+			}
+		}
+
+		if submitted == 0 {
+			continue
+		}
+
+		// records_dependencies has one row per dependency, even when several steps share it
+		seenDeps := map[int]bool{5: true}
+		dependencies.add(recordID, 5, 1, submitted)
+		actionTime := submitted
+		for i, stepID := range form.path {
+			depIDs := g.stepDepIDs[stepID]
+			if i == progress {
+				workflowState.add(recordID, stepID, 0, time.Unix(int64(actionTime), 0).UTC().Format("2006-01-02 15:04:05"), 0)
+				for _, depID := range depIDs {
+					if !seenDeps[depID] {
+						seenDeps[depID] = true
+						dependencies.add(recordID, depID, 0, nil)
+					}
+				}
+				break
+			}
+
+			actionTime += g.rnd.Intn(3 * 24 * 3600)
+			depID := 0
+			if len(depIDs) > 0 {
+				depID = depIDs[0]
+			}
+			for _, d := range depIDs {
+				if !seenDeps[d] {
+					seenDeps[d] = true
+					dependencies.add(recordID, d, 1, actionTime)
+				}
+			}
+			actionHistory.add(recordID, user.userID, stepID, depID, "approve", 8, actionTime, "", user.userMetadata)
+		}
+	}
+
+	for _, b := range []*batchInserter{records, categoryCount, data, workflowState, dependencies, actionHistory} {
+		b.flush()
+	}
+}
+
+// indicatorValue returns plausible data for an indicator based on its format
+func (g *recordGenerator) indicatorValue(ind generatorIndicator, created int) string {
+	switch ind.format {
+	case "text", "textarea":
+		return g.words(2 + g.rnd.Intn(8))
+	case "number":
+		return strconv.Itoa(g.rnd.Intn(1000))
+	case "currency":
+		return fmt.Sprintf("%d.%02d", g.rnd.Intn(100000), g.rnd.Intn(100))
+	case "date":
+		return time.Unix(int64(created+g.rnd.Intn(90*24*3600)), 0).UTC().Format("01/02/2006")
+	case "dropdown", "radio", "multiselect", "checkboxes":
+		if len(ind.options) == 0 {
+			return ""
+		}
+		return ind.options[g.rnd.Intn(len(ind.options))]
+	case "checkbox":
+		if g.rnd.Intn(2) == 0 {
+			return ""
+		}
+		if len(ind.options) > 0 {
+			return ind.options[0]
+		}
+		return "yes"
+	case "orgchart_employee":
+		if len(g.empUIDs) == 0 {
+			return ""
+		}
+		return strconv.Itoa(g.empUIDs[g.rnd.Intn(len(g.empUIDs))])
+	case "orgchart_group":
+		if len(g.groupIDs) == 0 {
+			return ""
+		}
+		return strconv.Itoa(g.groupIDs[g.rnd.Intn(len(g.groupIDs))])
+	}
+
+	// Attachments, grids, raw data and similar formats are left empty
+	return ""
+}
+
+func (g *recordGenerator) words(n int) string {
+	w := make([]string, n)
+	for i := range w {
+		w[i] = generatorWords[g.rnd.Intn(len(generatorWords))]
+	}
+	return strings.Join(w, " ")
+}
+
+func queryRows(db *sql.DB, query string, args ...any) *sql.Rows {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		log.Fatal("Could not query test database: ", err.Error())
+	}
+	return rows
+}
+
+func queryInts(db *sql.DB, query string) []int {
+	rows := queryRows(db, query)
+	defer rows.Close()
+
+	var ints []int
+	for rows.Next() {
+		var i int
+		rows.Scan(&i)
+		ints = append(ints, i)
+	}
+	return ints
+}
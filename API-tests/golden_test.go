@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// Golden files hold complete API responses, so a change anywhere in LEAF's
+// output shows up as a diff in review. Regenerate them after an intended change with:
+//
+//	go test -run=<tests> -update
+var updateGolden = flag.Bool("update", false, "rewrite testdata/*.golden.json with the current responses")
+
+// fixtureMaxRecordID is the highest recordID loaded from the fixtures. Records
+// above it were created during the run, so their IDs depend on test order.
+var fixtureMaxRecordID int
+
+// readFixtureMaxRecordID is called by TestMain before any tests create records
+func readFixtureMaxRecordID() int {
+	db := getDB()
+	defer db.Close()
+
+	var id int
+	db.QueryRow("SELECT COALESCE(MAX(recordID), 0) FROM " + testPortalDbName + ".records").Scan(&id)
+	return id
+}
+
+// goldenTimestampKeys hold times that change whenever a record is touched
+var goldenTimestampKeys = map[string]bool{
+	"date":         true,
+	"time":         true,
+	"timestamp":    true,
+	"submitted":    true,
+	"deleted":      true,
+	"lastNotified": true,
+	"lastModified": true,
+	"timeAdded":    true,
+}
+
+var goldenDateTime = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}[ T]\d{2}:\d{2}:\d{2}`)
+
+// goldenNormalizer masks volatile values in a decoded JSON response
+type goldenNormalizer struct {
+	maskKeys  map[string]bool
+	recordIDs map[string]string
+}
+
+// normalizeGolden masks timestamps, recordIDs created during the run, CSRF tokens,
+// and any extra keys, then returns indented JSON with sorted keys
+func normalizeGolden(body string, maskKeys ...string) (string, error) {
+	var v any
+	d := json.NewDecoder(strings.NewReader(body))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		return "", err
+	}
+
+	n := goldenNormalizer{maskKeys: map[string]bool{}, recordIDs: map[string]string{}}
+	for _, k := range maskKeys {
+		n.maskKeys[k] = true
+	}
+
+	out, err := json.MarshalIndent(n.normalize("", v), "", "    ")
+	if err != nil {
+		return "", err
+	}
+	return string(out) + "\n", nil
+}
+
+func (n *goldenNormalizer) normalize(key string, v any) any {
+	switch val := v.(type) {
+	case map[string]any:
+		// Visit keys in a fixed order so placeholder numbering is stable
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		out := make(map[string]any, len(val))
+		for _, k := range keys {
+			out[n.recordIDKey(k)] = n.normalize(k, val[k])
+		}
+		return out
+	case []any:
+		for i, child := range val {
+			val[i] = n.normalize(key, child)
+		}
+		return val
+	}
+
+	if n.maskKeys[key] {
+		return "<masked>"
+	}
+
+	s := fmt.Sprint(v)
+	switch {
+	case CsrfToken != "" && s == CsrfToken:
+		return "<CSRFToken>"
+	case key == "recordID":
+		if num, ok := v.(json.Number); ok {
+			return n.recordIDNumber(num)
+		}
+		return n.recordID(s)
+	case goldenTimestampKeys[key] && s != "0" && s != "" && v != nil:
+		return "<timestamp>"
+	case goldenDateTime.MatchString(s):
+		return "<timestamp>"
+	}
+
+	return v
+}
+
+// recordID replaces IDs of records created during the run with placeholders
+// numbered in the order they appear in the response
+func (n *goldenNormalizer) recordID(s string) string {
+	id, err := strconv.Atoi(s)
+	if err != nil || fixtureMaxRecordID == 0 || id <= fixtureMaxRecordID {
+		return s
+	}
+	if _, ok := n.recordIDs[s]; !ok {
+		n.recordIDs[s] = fmt.Sprintf("<recordID:%d>", len(n.recordIDs)+1)
+	}
+	return n.recordIDs[s]
+}
+
+// recordIDNumber is recordID for IDs the response has as numbers. The placeholder
+// stays a number, so a recordID changing between string and number shows up in
+// the diff: the Nth record created during the run becomes -N.
+func (n *goldenNormalizer) recordIDNumber(num json.Number) json.Number {
+	s := n.recordID(num.String())
+	if s == num.String() {
+		return num
+	}
+	placeholder := strings.TrimSuffix(strings.TrimPrefix(s, "<recordID:"), ">")
+	return json.Number("-" + placeholder)
+}
+
+// recordIDKey normalizes responses keyed by recordID, such as api/form/query
+func (n *goldenNormalizer) recordIDKey(k string) string {
+	if _, err := strconv.Atoi(k); err != nil {
+		return k
+	}
+	return n.recordID(k)
+}
+
+// assertGolden compares a normalized JSON response with testdata/<name>.golden.json.
+// maskKeys lists additional keys whose values change between runs.
+func assertGolden(t *testing.T, name string, body string, maskKeys ...string) {
+	t.Helper()
+
+	got, err := normalizeGolden(body, maskKeys...)
+	if err != nil {
+		t.Errorf("%s: response is not JSON: %v: %v", name, err, truncateString(body, 200))
+		return
+	}
+
+	path := filepath.Join("testdata", name+".golden.json")
+	if *updateGolden {
+		if err := os.WriteFile(path, []byte(got), 0664); err != nil {
+			t.Errorf("Could not write %s: %v", path, err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		t.Errorf("%s does not exist. Run with -update to create it, then commit it.", path)
+		return
+	} else if err != nil {
+		t.Errorf("Could not read %s: %v", path, err)
+		return
+	}
+
+	if diff := cmp.Diff(strings.Split(string(want), "\n"), strings.Split(got, "\n")); diff != "" {
+		t.Errorf("%s differs from %s (-want +got). If this is intended, run with -update:\n%s", name, path, diff)
+	}
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"io"
 	"log"
@@ -19,7 +18,7 @@ func getPortalGroup(url string) PortalGroupResponse {
 	b, _ := io.ReadAll(res.Body)
 
 	var m PortalGroupResponse
-	err := json.Unmarshal(b, &m)
+	err := decodeJSON(url, b, &m)
 
 	if err != nil {
 		log.Printf("JSON parsing error, couldn't parse: %v", string(b))
@@ -33,7 +32,7 @@ func getShortGroup(url string) ShortGroupResponse {
 	b, _ := io.ReadAll(res.Body)
 
 	var m ShortGroupResponse
-	err := json.Unmarshal(b, &m)
+	err := decodeJSON(url, b, &m)
 
 	if err != nil {
 		log.Printf("JSON parsing error, couldn't parse: %v", string(b))
@@ -47,7 +46,7 @@ func getNexusGroup(url string) NexusGroupResponse {
 	b, _ := io.ReadAll(res.Body)
 
 	var m NexusGroupResponse
-	err := json.Unmarshal(b, &m)
+	err := decodeJSON(url, b, &m)
 
 	if err != nil {
 		log.Printf("JSON parsing error, couldn't parse: %v", string(b))
@@ -65,7 +64,7 @@ func postNewGroup() string {
 	bodyBytes, _ := io.ReadAll(res.Body)
 
 	var c string
-	err := json.Unmarshal(bodyBytes, &c)
+	err := decodeJSON(RootOrgchartURL+`api/group`, bodyBytes, &c)
 	if err != nil {
 		log.Printf("JSON parsing error, couldn't parse: %v", string(bodyBytes))
 	}
@@ -84,7 +83,7 @@ func postNewTag(groupID string, tag string) string {
 	bodyBytes, _ := io.ReadAll(res.Body)
 
 	var c string
-	err := json.Unmarshal(bodyBytes, &c)
+	err := decodeJSON(RootOrgchartURL+`api/group/`+groupID+`/tag`, bodyBytes, &c)
 	if err != nil {
 		log.Printf("JSON parsing error, couldn't parse: %v", string(bodyBytes))
 	}
@@ -96,7 +95,7 @@ func importGroup(groupID string) string {
 	bodyBytes, _ := io.ReadAll(res.Body)
 
 	var c string
-	err := json.Unmarshal(bodyBytes, &c)
+	err := decodeJSON(RootURL+`api/system/importGroup/`+groupID, bodyBytes, &c)
 	if err != nil {
 		log.Printf("JSON parsing error, couldn't parse: %v", string(bodyBytes))
 	}
@@ -132,7 +131,7 @@ func removeFromNexus(postUrl string, tag string) error {
 	defer resp.Body.Close()
 
 	var c string
-	err = json.Unmarshal(bodyBytes, &c)
+	err = decodeJSON(postUrl, bodyBytes, &c)
 	if err != nil {
 		log.Printf("JSON parsing error, couldn't parse: %v", string(bodyBytes))
 	}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"crypto/tls"
 	"io"
 	"net/http"
 	"strings"
@@ -23,6 +22,13 @@ func httpGet(url string) (string, *http.Response) {
 	return string(bodyBytes), res
 }
 
+// readCSRFToken extracts the CSRF token embedded in a LEAF page
+func readCSRFToken(body string) string {
+	startIdx := strings.Index(body, "var CSRFToken = '") + 17
+	endIdx := strings.Index(body[startIdx:], "';")
+	return body[startIdx : startIdx+endIdx]
+}
+
 // min returns the smaller of two integers
 func min(a, b int) int {
 	if a < b {
@@ -41,11 +47,7 @@ func getKeys(m map[int]interface{}) []int {
 }
 
 var noRedirectClient = &http.Client{
-	Transport: &http.Transport{
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: true,
-		},
-	},
+	Transport: suiteTransport,
 	CheckRedirect: func(req *http.Request, via []*http.Request) error {
 		return http.ErrUseLastResponse
 	},
@@ -6,6 +6,8 @@ import (
 
 // Homepage, Default view
 func BenchmarkHomepage_defaultQuery(b *testing.B) {
+	defer profileSQL(b)()
+
 	for i := 0; i < b.N; i++ {
 		httpGet(RootURL + `api/form/query?q={"terms":[{"id":"title","operator":"LIKE","match":"***","gate":"AND"},{"id":"deleted","operator":"=","match":0,"gate":"AND"}],"joins":["service","status","categoryName"],"sort":{"column":"date","direction":"DESC"},"limit":50}`)
 	}
@@ -13,6 +15,8 @@ func BenchmarkHomepage_defaultQuery(b *testing.B) {
 
 // Inbox, Default view
 func BenchmarkInbox_nonAdminActionable(b *testing.B) {
+	defer profileSQL(b)()
+
 	for i := 0; i < b.N; i++ {
 		httpGet(RootURL + `api/form/query?q={"terms":[{"id":"stepID","operator":"=","match":"actionable","gate":"AND"},{"id":"deleted","operator":"=","match":0,"gate":"AND"}],"joins":["service"],"sort":{},"limit":1000,"limitOffset":0}&x-filterData=recordID,title&masquerade=nonAdmin`)
 	}
@@ -20,6 +24,8 @@ func BenchmarkInbox_nonAdminActionable(b *testing.B) {
 
 // Inbox, Non-Admin, Organized by roles
 func BenchmarkInbox_nonAdminActionableRoles(b *testing.B) {
+	defer profileSQL(b)()
+
 	for i := 0; i < b.N; i++ {
 		httpGet(RootURL + `api/form/query/?q={"terms":[{"id":"stepID","operator":"=","match":"actionable","gate":"AND"},{"id":"deleted","operator":"=","match":0,"gate":"AND"}],"joins":["service","categoryName","status","unfilledDependencies"],"sort":{},"limit":1000,"limitOffset":0}&x-filterData=recordID,categoryIDs,categoryNames,date,title,service,submitted,priority,stepID,blockingStepID,lastStatus,stepTitle,action_history.time,unfilledDependencyData&masquerade=nonAdmin`)
 	}
@@ -27,6 +33,8 @@ func BenchmarkInbox_nonAdminActionableRoles(b *testing.B) {
 
 // Inbox, Admin, Organized by roles
 func BenchmarkInbox_adminActionableRoles(b *testing.B) {
+	defer profileSQL(b)()
+
 	for i := 0; i < b.N; i++ {
 		httpGet(RootURL + `api/form/query/?q={"terms":[{"id":"stepID","operator":"=","match":"actionable","gate":"AND"},{"id":"deleted","operator":"=","match":0,"gate":"AND"}],"joins":["service","categoryName","status","unfilledDependencies"],"sort":{},"limit":1000,"limitOffset":0}&x-filterData=recordID,categoryIDs,categoryNames,date,title,service,submitted,priority,stepID,blockingStepID,lastStatus,stepTitle,action_history.time,unfilledDependencyData`)
 	}
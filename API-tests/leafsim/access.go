@@ -0,0 +1,123 @@
+package leafsim
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Special dependencies, which are resolved from the record rather than a group
+const (
+	depServiceChief     = 1
+	depPersonDesignated = -1
+	depRequestor        = -2
+	depGroupDesignated  = -3
+	depLeafAgent        = -4
+)
+
+func sameUser(a string, b string) bool {
+	return a != "" && strings.EqualFold(a, b)
+}
+
+// canRead applies need to know: records of a need to know form are only
+// readable by admins, the initiator, and users who acted or can act on them
+func (s *Simulator) canRead(rec *record, id identity) bool {
+	if id.admin || sameUser(rec.UserID, id.userID) {
+		return true
+	}
+
+	needToKnow := false
+	for _, c := range rec.Categories {
+		if cat := s.m.categories[c]; cat != nil && cat.NeedToKnow == 1 {
+			needToKnow = true
+		}
+	}
+	if !needToKnow {
+		return true
+	}
+
+	for _, h := range s.m.history {
+		if h.RecordID == rec.RecordID && sameUser(h.UserID, id.userID) {
+			return true
+		}
+	}
+	for _, state := range s.m.states[rec.RecordID] {
+		if st := s.m.steps[state.StepID]; st != nil {
+			for _, dep := range st.Dependencies {
+				if s.isApprover(rec, st, dep, id) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// canWrite allows admins, and initiators while the record is writable by them
+func (s *Simulator) canWrite(rec *record, id identity) bool {
+	return id.admin || (sameUser(rec.UserID, id.userID) && rec.IsWritableUser == 1)
+}
+
+// isApprover reports whether the user is assigned to a dependency of a step
+func (s *Simulator) isApprover(rec *record, st *step, dependencyID int, id identity) bool {
+	switch dependencyID {
+	case depRequestor:
+		return sameUser(rec.UserID, id.userID)
+	case depPersonDesignated:
+		if d := s.m.getData(rec.RecordID, st.IndicatorIDForAssignedEmpUID); d != nil && d.Metadata != nil {
+			return sameUser(d.Metadata.UserName, id.userID)
+		}
+		return false
+	case depGroupDesignated:
+		if d := s.m.getData(rec.RecordID, st.IndicatorIDForAssignedGroupID); d != nil {
+			groupID, err := strconv.Atoi(d.Value)
+			return err == nil && id.groups[groupID]
+		}
+		return false
+	case depServiceChief:
+		for _, chief := range s.m.chiefs[rec.ServiceID] {
+			if sameUser(chief, id.userID) {
+				return true
+			}
+		}
+		return false
+	case depLeafAgent:
+		return false
+	}
+
+	for _, g := range s.m.depGroups[dependencyID] {
+		if id.groups[g] {
+			return true
+		}
+	}
+	return false
+}
+
+// canAct allows admins to take any action, like LEAF does
+func (s *Simulator) canAct(rec *record, st *step, dependencyID int, id identity) bool {
+	return id.admin || s.isApprover(rec, st, dependencyID, id)
+}
+
+// approver names who a dependency is assigned to, where the record says so
+func (s *Simulator) approver(rec *record, st *step, dependencyID int) (name *string, uid *string, who *Person) {
+	switch dependencyID {
+	case depRequestor:
+		if rec.UserMetadata != nil {
+			n, e := rec.UserMetadata.name(), rec.UserMetadata.Email
+			return &n, &e, rec.UserMetadata
+		}
+	case depPersonDesignated:
+		if d := s.m.getData(rec.RecordID, st.IndicatorIDForAssignedEmpUID); d != nil && d.Metadata != nil {
+			n, e := d.Metadata.name(), d.Metadata.Email
+			return &n, &e, d.Metadata
+		}
+	case depGroupDesignated:
+		if d := s.m.getData(rec.RecordID, st.IndicatorIDForAssignedGroupID); d != nil {
+			groupID, _ := strconv.Atoi(d.Value)
+			if g, ok := s.m.groups[groupID]; ok {
+				uid := d.Value
+				return &g, &uid, nil
+			}
+		}
+	}
+	return nil, nil, nil
+}
@@ -0,0 +1,206 @@
+package leafsim
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Row is one row of a table in a SQL dump. Values are nil (NULL), int64,
+// float64 or string.
+type Row map[string]any
+
+// ParseDump reads the rows of every INSERT statement in a MySQL dump, such as
+// the fixtures in API-tests/database. Schema statements are ignored.
+func ParseDump(dump string) (map[string][]Row, error) {
+	tables := map[string][]Row{}
+
+	p := dumpParser{s: dump}
+	for {
+		i := strings.Index(p.s[p.pos:], "INSERT INTO ")
+		if i < 0 {
+			return tables, nil
+		}
+		p.pos += i + len("INSERT INTO ")
+
+		table, columns, err := p.insertHeader()
+		if err != nil {
+			return nil, err
+		}
+
+		for {
+			values, err := p.tuple()
+			if err != nil {
+				return nil, fmt.Errorf("table %s: %w", table, err)
+			}
+			if len(values) != len(columns) {
+				return nil, fmt.Errorf("table %s: row has %d values, want %d", table, len(values), len(columns))
+			}
+			row := make(Row, len(columns))
+			for i, c := range columns {
+				row[c] = values[i]
+			}
+			tables[table] = append(tables[table], row)
+
+			p.skipSpace()
+			if p.consume(",") {
+				continue
+			}
+			if p.consume(";") {
+				break
+			}
+			return nil, fmt.Errorf("table %s: expected , or ; at offset %d", table, p.pos)
+		}
+	}
+}
+
+type dumpParser struct {
+	s   string
+	pos int
+}
+
+func (p *dumpParser) skipSpace() {
+	for p.pos < len(p.s) && strings.ContainsRune(" \t\r\n", rune(p.s[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *dumpParser) consume(token string) bool {
+	p.skipSpace()
+	if strings.HasPrefix(p.s[p.pos:], token) {
+		p.pos += len(token)
+		return true
+	}
+	return false
+}
+
+// insertHeader reads "`table` (`col`, ...) VALUES"
+func (p *dumpParser) insertHeader() (string, []string, error) {
+	table, err := p.identifier()
+	if err != nil {
+		return "", nil, err
+	}
+	if !p.consume("(") {
+		return "", nil, fmt.Errorf("table %s: INSERT without a column list", table)
+	}
+
+	var columns []string
+	for {
+		c, err := p.identifier()
+		if err != nil {
+			return "", nil, fmt.Errorf("table %s: %w", table, err)
+		}
+		columns = append(columns, c)
+		if p.consume(")") {
+			break
+		}
+		if !p.consume(",") {
+			return "", nil, fmt.Errorf("table %s: malformed column list", table)
+		}
+	}
+
+	if !p.consume("VALUES") {
+		return "", nil, fmt.Errorf("table %s: expected VALUES", table)
+	}
+	return table, columns, nil
+}
+
+func (p *dumpParser) identifier() (string, error) {
+	p.skipSpace()
+	if !p.consume("`") {
+		return "", fmt.Errorf("expected identifier at offset %d", p.pos)
+	}
+	end := strings.IndexByte(p.s[p.pos:], '`')
+	if end < 0 {
+		return "", fmt.Errorf("unterminated identifier at offset %d", p.pos)
+	}
+	name := p.s[p.pos : p.pos+end]
+	p.pos += end + 1
+	return name, nil
+}
+
+// tuple reads "(value, value, ...)"
+func (p *dumpParser) tuple() ([]any, error) {
+	if !p.consume("(") {
+		return nil, fmt.Errorf("expected ( at offset %d", p.pos)
+	}
+
+	var values []any
+	for {
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+		if p.consume(")") {
+			return values, nil
+		}
+		if !p.consume(",") {
+			return nil, fmt.Errorf("expected , or ) at offset %d", p.pos)
+		}
+	}
+}
+
+func (p *dumpParser) value() (any, error) {
+	p.skipSpace()
+	if p.pos >= len(p.s) {
+		return nil, fmt.Errorf("unexpected end of dump")
+	}
+
+	if p.s[p.pos] == '\'' {
+		return p.quoted()
+	}
+
+	end := p.pos
+	for end < len(p.s) && !strings.ContainsRune(",) \t\r\n", rune(p.s[end])) {
+		end++
+	}
+	token := p.s[p.pos:end]
+	p.pos = end
+
+	if strings.EqualFold(token, "NULL") {
+		return nil, nil
+	}
+	if n, err := strconv.ParseInt(token, 10, 64); err == nil {
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(token, 64); err == nil {
+		return f, nil
+	}
+	return nil, fmt.Errorf("unexpected value %q at offset %d", token, p.pos)
+}
+
+// quoted reads a single quoted string with MySQL's backslash escapes
+func (p *dumpParser) quoted() (string, error) {
+	var sb strings.Builder
+	p.pos++ // opening quote
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		switch {
+		case c == '\\' && p.pos+1 < len(p.s):
+			p.pos++
+			switch e := p.s[p.pos]; e {
+			case 'n':
+				sb.WriteByte('\n')
+			case 'r':
+				sb.WriteByte('\r')
+			case 't':
+				sb.WriteByte('\t')
+			case '0':
+				sb.WriteByte(0)
+			default:
+				sb.WriteByte(e)
+			}
+		case c == '\'' && p.pos+1 < len(p.s) && p.s[p.pos+1] == '\'':
+			sb.WriteByte('\'')
+			p.pos++
+		case c == '\'':
+			p.pos++
+			return sb.String(), nil
+		default:
+			sb.WriteByte(c)
+		}
+		p.pos++
+	}
+	return "", fmt.Errorf("unterminated string")
+}
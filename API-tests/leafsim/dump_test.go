@@ -0,0 +1,60 @@
+package leafsim
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseDump_Values(t *testing.T) {
+	dump := "SET NAMES utf8;\n" +
+		"DROP TABLE IF EXISTS `records`;\n" +
+		"CREATE TABLE `records` (\n  `recordID` mediumint unsigned NOT NULL AUTO_INCREMENT\n);\n\n" +
+		"INSERT INTO `records` (`recordID`, `title`, `lastStatus`, `userMetadata`) VALUES\n" +
+		"(1,\t'O\\'Tester said \\\"hi\\\"\\nC:\\\\tmp',\tNULL,\t'{\\\"userName\\\": \\\"tester\\\"}'),\n" +
+		"(2,\t'it''s, (fine)',\t'Approved',\tNULL);\n" +
+		"INSERT INTO `groups` (`groupID`, `name`) VALUES\n(-1,\t'Quadrad');\n"
+
+	got, err := ParseDump(dump)
+	if err != nil {
+		t.Fatalf("ParseDump error = %v, want = nil", err)
+	}
+
+	want := map[string][]Row{
+		"records": {
+			{"recordID": int64(1), "title": "O'Tester said \"hi\"\nC:\\tmp", "lastStatus": nil, "userMetadata": `{"userName": "tester"}`},
+			{"recordID": int64(2), "title": "it's, (fine)", "lastStatus": "Approved", "userMetadata": nil},
+		},
+		"groups": {
+			{"groupID": int64(-1), "name": "Quadrad"},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ParseDump mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseDump_ColumnCountMismatch(t *testing.T) {
+	_, err := ParseDump("INSERT INTO `groups` (`groupID`, `name`) VALUES\n(1);\n")
+	if err == nil {
+		t.Errorf("ParseDump error = nil, want = error for a row with too few values")
+	}
+}
+
+func TestParseDump_PortalFixture(t *testing.T) {
+	sim := loadFixture(t)
+
+	rec := sim.m.records[505]
+	if rec == nil {
+		t.Fatalf("record 505 not loaded")
+	}
+	if got, want := rec.UserMetadata.Email, "Agueda.Howell@fake-email.com"; got != want {
+		t.Errorf("record 505 userMetadata.email = %v, want = %v", got, want)
+	}
+	if got, want := rec.Categories, []string{"form_5ea07"}; !cmp.Equal(got, want) {
+		t.Errorf("record 505 categories = %v, want = %v", got, want)
+	}
+	if got, want := sim.m.steps[1].Dependencies, []int{-1, 9}; !cmp.Equal(got, want) {
+		t.Errorf("step 1 dependencies = %v, want = %v", got, want)
+	}
+}
@@ -0,0 +1,129 @@
+package leafsim
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// formNew creates a record. Fields are title, service, priority,
+// num<categoryID> (e.g. numform_5ea07) for each form, and indicatorIDs for data.
+func (s *Simulator) formNew(w http.ResponseWriter, r *http.Request, id identity) {
+	now := int(s.opts.Now().Unix())
+
+	rec := &record{
+		RecordID:        s.m.nextRecordID,
+		Date:            now,
+		ServiceID:       atoi(r.PostForm.Get("service")),
+		UserID:          id.userID,
+		Title:           r.PostForm.Get("title"),
+		Priority:        atoi(r.PostForm.Get("priority")),
+		IsWritableUser:  1,
+		IsWritableGroup: 1,
+		UserMetadata:    &Person{UserName: id.userID},
+	}
+
+	for key, values := range r.PostForm {
+		if categoryID, ok := strings.CutPrefix(key, "num"); ok && strings.HasPrefix(categoryID, "form_") && atoi(values[0]) > 0 {
+			if _, exists := s.m.categories[categoryID]; !exists {
+				writeJSON(w, http.StatusBadRequest, "Invalid form: "+categoryID)
+				return
+			}
+			rec.Categories = append(rec.Categories, categoryID)
+		}
+	}
+	sort.Strings(rec.Categories)
+
+	s.m.records[rec.RecordID] = rec
+	s.m.nextRecordID++
+	s.writeData(rec, r, id, now)
+
+	writeJSON(w, http.StatusOK, strconv.Itoa(rec.RecordID))
+}
+
+// formWrite saves data fields, keyed by indicatorID, to a record
+func (s *Simulator) formWrite(w http.ResponseWriter, r *http.Request, id identity, recordID int) {
+	rec := s.m.records[recordID]
+	if rec == nil {
+		writeJSON(w, http.StatusNotFound, "Record not found")
+		return
+	}
+	if !s.canWrite(rec, id) {
+		writeJSON(w, http.StatusUnauthorized, "No write access (data field)")
+		return
+	}
+
+	s.writeData(rec, r, id, int(s.opts.Now().Unix()))
+	writeJSON(w, http.StatusOK, "1")
+}
+
+func (s *Simulator) writeData(rec *record, r *http.Request, id identity, now int) {
+	series := 1
+	if v := r.PostForm.Get("series"); v != "" {
+		series = atoi(v)
+	}
+
+	for key, values := range r.PostForm {
+		indicatorID, err := strconv.Atoi(key)
+		if err != nil {
+			continue
+		}
+		if _, ok := s.m.indicators[indicatorID]; !ok {
+			continue
+		}
+		s.m.setData(rec.RecordID, indicatorID, series, &dataValue{
+			Value:     values[0],
+			Timestamp: now,
+			UserID:    id.userID,
+		})
+	}
+}
+
+// formDataItem is one field in form/{id}/data
+type formDataItem struct {
+	IndicatorID int    `json:"indicatorID"`
+	Series      int    `json:"series"`
+	Name        string `json:"name"`
+	Format      string `json:"format"`
+	Value       string `json:"value"`
+	Timestamp   int    `json:"timestamp"`
+	IsSensitive int    `json:"is_sensitive"`
+	IsMasked    int    `json:"isMasked"`
+}
+
+// formData lists a record's data by indicatorID and series. Sensitive values
+// are masked for users other than admins and the initiator.
+func (s *Simulator) formData(w http.ResponseWriter, id identity, recordID int) {
+	rec := s.m.records[recordID]
+	if rec == nil || !s.canRead(rec, id) {
+		writeJSONBytes(w, http.StatusOK, []byte(`[]`))
+		return
+	}
+
+	out := map[int]map[int]formDataItem{}
+	for indicatorID, bySeries := range s.m.data[recordID] {
+		ind := s.m.indicators[indicatorID]
+		if ind == nil {
+			continue
+		}
+		out[indicatorID] = map[int]formDataItem{}
+		for series, d := range bySeries {
+			item := formDataItem{
+				IndicatorID: indicatorID,
+				Series:      series,
+				Name:        ind.Name,
+				Format:      ind.Format,
+				Value:       d.Value,
+				Timestamp:   d.Timestamp,
+				IsSensitive: ind.IsSensitive,
+			}
+			if ind.IsSensitive == 1 && !id.admin && !sameUser(rec.UserID, id.userID) {
+				item.Value = ""
+				item.IsMasked = 1
+			}
+			out[indicatorID][series] = item
+		}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
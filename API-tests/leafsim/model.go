@@ -0,0 +1,395 @@
+package leafsim
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Person is the userMetadata LEAF stores with records, data and actions
+type Person struct {
+	FirstName  string `json:"firstName"`
+	LastName   string `json:"lastName"`
+	MiddleName string `json:"middleName"`
+	Email      string `json:"email"`
+	UserName   string `json:"userName"`
+}
+
+func (p Person) name() string {
+	return strings.TrimSpace(p.FirstName + " " + p.LastName)
+}
+
+type record struct {
+	RecordID        int
+	Date            int
+	ServiceID       int
+	UserID          string
+	Title           string
+	Priority        int
+	LastStatus      string
+	Submitted       int
+	Deleted         int
+	IsWritableUser  int
+	IsWritableGroup int
+	UserMetadata    *Person
+	Categories      []string
+}
+
+type dataValue struct {
+	Value     string
+	Metadata  *Person
+	Timestamp int
+	UserID    string
+}
+
+type category struct {
+	CategoryID   string
+	CategoryName string
+	WorkflowID   int
+	NeedToKnow   int
+}
+
+type indicator struct {
+	IndicatorID int
+	Name        string
+	Format      string
+	CategoryID  string
+	IsSensitive int
+}
+
+type step struct {
+	WorkflowID                    int
+	StepID                        int
+	StepTitle                     string
+	StepBgColor                   string
+	StepFontColor                 string
+	StepBorder                    string
+	JsSrc                         string
+	PosX                          int
+	PosY                          int
+	IndicatorIDForAssignedEmpUID  int
+	IndicatorIDForAssignedGroupID int
+	RequiresDigitalSignature      int
+	StepData                      string
+	Dependencies                  []int
+}
+
+type route struct {
+	WorkflowID         int
+	StepID             int
+	NextStepID         int
+	ActionType         string
+	DisplayConditional string
+}
+
+type action struct {
+	ActionType          string
+	ActionText          string
+	ActionTextPasttense string
+	ActionIcon          string
+	ActionAlignment     string
+	Sort                int
+	FillDependency      int
+	Deleted             int
+}
+
+type workflowState struct {
+	StepID         int
+	BlockingStepID int
+	LastNotified   string
+}
+
+type actionHistory struct {
+	RecordID     int
+	UserID       string
+	StepID       int
+	DependencyID int
+	ActionType   string
+	Time         int
+	Comment      string
+	UserMetadata *Person
+}
+
+type service struct {
+	ServiceID          int
+	Service            string
+	AbbreviatedService string
+	GroupID            int
+}
+
+// model is the portal database held in memory
+type model struct {
+	records      map[int]*record
+	data         map[int]map[int]map[int]*dataValue // recordID -> indicatorID -> series
+	categories   map[string]*category
+	indicators   map[int]*indicator
+	steps        map[int]*step
+	routes       []route
+	actions      map[string]*action
+	dependencies map[int]string
+	depGroups    map[int][]int            // dependencyID -> groupIDs
+	states       map[int][]*workflowState // recordID -> current steps
+	filled       map[int]map[int]int      // recordID -> dependencyID -> filled
+	history      []*actionHistory
+	services     map[int]*service
+	chiefs       map[int][]string // serviceID -> userIDs
+	groups       map[int]string
+	members      map[string]map[int]bool // lowercased userID -> groupIDs
+	nextRecordID int
+}
+
+func loadModel(tables map[string][]Row) (*model, error) {
+	m := &model{
+		records:      map[int]*record{},
+		data:         map[int]map[int]map[int]*dataValue{},
+		categories:   map[string]*category{},
+		indicators:   map[int]*indicator{},
+		steps:        map[int]*step{},
+		actions:      map[string]*action{},
+		dependencies: map[int]string{},
+		depGroups:    map[int][]int{},
+		states:       map[int][]*workflowState{},
+		filled:       map[int]map[int]int{},
+		services:     map[int]*service{},
+		chiefs:       map[int][]string{},
+		groups:       map[int]string{},
+		members:      map[string]map[int]bool{},
+	}
+
+	if len(tables["records"]) == 0 {
+		return nil, fmt.Errorf("the dump has no records")
+	}
+
+	for _, r := range tables["records"] {
+		rec := &record{
+			RecordID:        num(r["recordID"]),
+			Date:            num(r["date"]),
+			ServiceID:       num(r["serviceID"]),
+			UserID:          str(r["userID"]),
+			Title:           str(r["title"]),
+			Priority:        num(r["priority"]),
+			LastStatus:      str(r["lastStatus"]),
+			Submitted:       num(r["submitted"]),
+			Deleted:         num(r["deleted"]),
+			IsWritableUser:  num(r["isWritableUser"]),
+			IsWritableGroup: num(r["isWritableGroup"]),
+			UserMetadata:    person(r["userMetadata"]),
+		}
+		m.records[rec.RecordID] = rec
+		if rec.RecordID >= m.nextRecordID {
+			m.nextRecordID = rec.RecordID + 1
+		}
+	}
+
+	for _, r := range tables["category_count"] {
+		if rec := m.records[num(r["recordID"])]; rec != nil && num(r["count"]) > 0 {
+			rec.Categories = append(rec.Categories, str(r["categoryID"]))
+		}
+	}
+	for _, rec := range m.records {
+		sort.Strings(rec.Categories)
+	}
+
+	for _, r := range tables["data"] {
+		m.setData(num(r["recordID"]), num(r["indicatorID"]), num(r["series"]), &dataValue{
+			Value:     str(r["data"]),
+			Metadata:  person(r["metadata"]),
+			Timestamp: num(r["timestamp"]),
+			UserID:    str(r["userID"]),
+		})
+	}
+
+	for _, r := range tables["categories"] {
+		c := &category{
+			CategoryID:   str(r["categoryID"]),
+			CategoryName: str(r["categoryName"]),
+			WorkflowID:   num(r["workflowID"]),
+			NeedToKnow:   num(r["needToKnow"]),
+		}
+		m.categories[c.CategoryID] = c
+	}
+
+	for _, r := range tables["indicators"] {
+		ind := &indicator{
+			IndicatorID: num(r["indicatorID"]),
+			Name:        str(r["name"]),
+			Format:      str(r["format"]),
+			CategoryID:  str(r["categoryID"]),
+			IsSensitive: num(r["is_sensitive"]),
+		}
+		m.indicators[ind.IndicatorID] = ind
+	}
+
+	for _, r := range tables["workflow_steps"] {
+		s := &step{
+			WorkflowID:                    num(r["workflowID"]),
+			StepID:                        num(r["stepID"]),
+			StepTitle:                     str(r["stepTitle"]),
+			StepBgColor:                   str(r["stepBgColor"]),
+			StepFontColor:                 str(r["stepFontColor"]),
+			StepBorder:                    str(r["stepBorder"]),
+			JsSrc:                         str(r["jsSrc"]),
+			PosX:                          num(r["posX"]),
+			PosY:                          num(r["posY"]),
+			IndicatorIDForAssignedEmpUID:  num(r["indicatorID_for_assigned_empUID"]),
+			IndicatorIDForAssignedGroupID: num(r["indicatorID_for_assigned_groupID"]),
+			RequiresDigitalSignature:      num(r["requiresDigitalSignature"]),
+			StepData:                      str(r["stepData"]),
+		}
+		m.steps[s.StepID] = s
+	}
+	for _, r := range tables["step_dependencies"] {
+		if s := m.steps[num(r["stepID"])]; s != nil {
+			s.Dependencies = append(s.Dependencies, num(r["dependencyID"]))
+		}
+	}
+	for _, s := range m.steps {
+		sort.Ints(s.Dependencies)
+	}
+
+	for _, r := range tables["workflow_routes"] {
+		m.routes = append(m.routes, route{
+			WorkflowID:         num(r["workflowID"]),
+			StepID:             num(r["stepID"]),
+			NextStepID:         num(r["nextStepID"]),
+			ActionType:         str(r["actionType"]),
+			DisplayConditional: str(r["displayConditional"]),
+		})
+	}
+
+	for _, r := range tables["actions"] {
+		a := &action{
+			ActionType:          str(r["actionType"]),
+			ActionText:          str(r["actionText"]),
+			ActionTextPasttense: str(r["actionTextPasttense"]),
+			ActionIcon:          str(r["actionIcon"]),
+			ActionAlignment:     str(r["actionAlignment"]),
+			Sort:                num(r["sort"]),
+			FillDependency:      num(r["fillDependency"]),
+			Deleted:             num(r["deleted"]),
+		}
+		m.actions[a.ActionType] = a
+	}
+
+	for _, r := range tables["dependencies"] {
+		m.dependencies[num(r["dependencyID"])] = str(r["description"])
+	}
+	for _, r := range tables["dependency_privs"] {
+		m.depGroups[num(r["dependencyID"])] = append(m.depGroups[num(r["dependencyID"])], num(r["groupID"]))
+	}
+
+	for _, r := range tables["records_workflow_state"] {
+		m.states[num(r["recordID"])] = append(m.states[num(r["recordID"])], &workflowState{
+			StepID:         num(r["stepID"]),
+			BlockingStepID: num(r["blockingStepID"]),
+			LastNotified:   str(r["lastNotified"]),
+		})
+	}
+
+	for _, r := range tables["records_dependencies"] {
+		m.setFilled(num(r["recordID"]), num(r["dependencyID"]), num(r["filled"]))
+	}
+
+	for _, r := range tables["action_history"] {
+		m.history = append(m.history, &actionHistory{
+			RecordID:     num(r["recordID"]),
+			UserID:       str(r["userID"]),
+			StepID:       num(r["stepID"]),
+			DependencyID: num(r["dependencyID"]),
+			ActionType:   str(r["actionType"]),
+			Time:         num(r["time"]),
+			Comment:      str(r["comment"]),
+			UserMetadata: person(r["userMetadata"]),
+		})
+	}
+
+	for _, r := range tables["services"] {
+		s := &service{
+			ServiceID:          num(r["serviceID"]),
+			Service:            str(r["service"]),
+			AbbreviatedService: str(r["abbreviatedService"]),
+			GroupID:            num(r["groupID"]),
+		}
+		m.services[s.ServiceID] = s
+	}
+	for _, r := range tables["service_chiefs"] {
+		if num(r["active"]) == 1 {
+			m.chiefs[num(r["serviceID"])] = append(m.chiefs[num(r["serviceID"])], str(r["userID"]))
+		}
+	}
+
+	for _, r := range tables["groups"] {
+		m.groups[num(r["groupID"])] = str(r["name"])
+	}
+	for _, r := range tables["users"] {
+		if num(r["active"]) != 1 {
+			continue
+		}
+		userID := strings.ToLower(str(r["userID"]))
+		if m.members[userID] == nil {
+			m.members[userID] = map[int]bool{}
+		}
+		m.members[userID][num(r["groupID"])] = true
+	}
+
+	return m, nil
+}
+
+func (m *model) setData(recordID int, indicatorID int, series int, v *dataValue) {
+	if m.data[recordID] == nil {
+		m.data[recordID] = map[int]map[int]*dataValue{}
+	}
+	if m.data[recordID][indicatorID] == nil {
+		m.data[recordID][indicatorID] = map[int]*dataValue{}
+	}
+	m.data[recordID][indicatorID][series] = v
+}
+
+func (m *model) getData(recordID int, indicatorID int) *dataValue {
+	return m.data[recordID][indicatorID][1]
+}
+
+func (m *model) setFilled(recordID int, dependencyID int, filled int) {
+	if m.filled[recordID] == nil {
+		m.filled[recordID] = map[int]int{}
+	}
+	m.filled[recordID][dependencyID] = filled
+}
+
+// num converts a dump value to an int; NULL and non-numeric strings are 0
+func num(v any) int {
+	switch val := v.(type) {
+	case int64:
+		return int(val)
+	case float64:
+		return int(val)
+	case string:
+		n, _ := strconv.Atoi(val)
+		return n
+	}
+	return 0
+}
+
+func str(v any) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	}
+	return fmt.Sprint(v)
+}
+
+func person(v any) *Person {
+	s, ok := v.(string)
+	if !ok || s == "" {
+		return nil
+	}
+	var p Person
+	if json.Unmarshal([]byte(s), &p) != nil {
+		return nil
+	}
+	return &p
+}
@@ -0,0 +1,430 @@
+package leafsim
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// formQuery is the q parameter of form/query
+type formQuery struct {
+	Terms []queryTerm `json:"terms"`
+	Joins []string    `json:"joins"`
+	Sort  struct {
+		Column    string `json:"column"`
+		Direction string `json:"direction"`
+	} `json:"sort"`
+	Limit       *int  `json:"limit"`
+	LimitOffset int   `json:"limitOffset"`
+	GetData     []any `json:"getData"`
+}
+
+type queryTerm struct {
+	ID          string `json:"id"`
+	IndicatorID any    `json:"indicatorID"`
+	Operator    string `json:"operator"`
+	Match       any    `json:"match"`
+	Gate        string `json:"gate"`
+}
+
+// formQuery runs a query. Terms are combined left to right by their gate.
+func (s *Simulator) formQuery(w http.ResponseWriter, r *http.Request, id identity) {
+	var q formQuery
+	if err := json.Unmarshal([]byte(r.URL.Query().Get("q")), &q); err != nil {
+		writeJSON(w, http.StatusBadRequest, "Invalid query: "+err.Error())
+		return
+	}
+
+	var matched []*record
+	for _, rec := range s.m.records {
+		ok, err := s.matchTerms(rec, q.Terms, id)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if ok && s.canRead(rec, id) {
+			matched = append(matched, rec)
+		}
+	}
+
+	column, desc := q.Sort.Column, !strings.EqualFold(q.Sort.Direction, "ASC")
+	if column == "" {
+		column = "recordID"
+	}
+	rows := make([]map[string]any, len(matched))
+	for i, rec := range matched {
+		rows[i] = s.queryRow(rec, q, id)
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		c := compareValues(fmt.Sprint(rows[i][column]), fmt.Sprint(rows[j][column]))
+		if c == 0 {
+			c = compareValues(fmt.Sprint(rows[i]["recordID"]), fmt.Sprint(rows[j]["recordID"]))
+		}
+		if desc {
+			return c > 0
+		}
+		return c < 0
+	})
+
+	if q.LimitOffset > 0 {
+		rows = rows[min(q.LimitOffset, len(rows)):]
+	}
+	if q.Limit != nil && *q.Limit >= 0 && *q.Limit < len(rows) {
+		rows = rows[:*q.Limit]
+	}
+
+	var filter []string
+	if f := r.URL.Query().Get("x-filterData"); f != "" {
+		filter = strings.Split(f, ",")
+	}
+
+	// The response is an object keyed by recordID in the query's order
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, row := range rows {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		b, err := json.Marshal(filterFields(row, filter))
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		fmt.Fprintf(&buf, `"%d":%s`, row["recordID"], b)
+	}
+	buf.WriteByte('}')
+	writeJSONBytes(w, http.StatusOK, buf.Bytes())
+}
+
+func (s *Simulator) matchTerms(rec *record, terms []queryTerm, id identity) (bool, error) {
+	result := true
+	for i, t := range terms {
+		ok, err := s.matchTerm(rec, t, id)
+		if err != nil {
+			return false, err
+		}
+		switch {
+		case i == 0:
+			result = ok
+		case strings.EqualFold(t.Gate, "OR"):
+			result = result || ok
+		default:
+			result = result && ok
+		}
+	}
+	return result, nil
+}
+
+func (s *Simulator) matchTerm(rec *record, t queryTerm, id identity) (bool, error) {
+	match := ""
+	switch m := t.Match.(type) {
+	case float64:
+		match = strconv.FormatFloat(m, 'f', -1, 64)
+	case nil:
+	default:
+		match = fmt.Sprint(m)
+	}
+
+	switch t.ID {
+	case "recordID":
+		return compare(strconv.Itoa(rec.RecordID), t.Operator, match)
+	case "recordIDs":
+		found := false
+		for _, v := range strings.Split(match, ",") {
+			found = found || strings.TrimSpace(v) == strconv.Itoa(rec.RecordID)
+		}
+		return negate(t.Operator, found), nil
+	case "title":
+		return compare(rec.Title, t.Operator, match)
+	case "userID":
+		return compare(rec.UserID, t.Operator, match)
+	case "serviceID":
+		return compare(strconv.Itoa(rec.ServiceID), t.Operator, match)
+	case "priority":
+		return compare(strconv.Itoa(rec.Priority), t.Operator, match)
+	case "date", "submitted", "deleted":
+		value := map[string]int{"date": rec.Date, "submitted": rec.Submitted, "deleted": rec.Deleted}[t.ID]
+		if d, err := time.Parse("2006-01-02", match); err == nil {
+			match = strconv.FormatInt(d.Unix(), 10)
+		}
+		return compare(strconv.Itoa(value), t.Operator, match)
+	case "categoryID":
+		found := false
+		for _, c := range rec.Categories {
+			found = found || c == match
+		}
+		return negate(t.Operator, found), nil
+	case "stepID":
+		return negate(t.Operator, s.matchStep(rec, match, id)), nil
+	case "data":
+		indicatorID, _ := strconv.Atoi(fmt.Sprint(t.IndicatorID))
+		value := ""
+		if d := s.m.getData(rec.RecordID, indicatorID); d != nil {
+			value = d.Value
+		}
+		return compare(value, t.Operator, match)
+	}
+	return false, fmt.Errorf("leafsim: term %q is not simulated", t.ID)
+}
+
+// matchStep handles stepID terms, which also accept submitted, notSubmitted,
+// resolved, deleted and actionable
+func (s *Simulator) matchStep(rec *record, match string, id identity) bool {
+	states := s.m.states[rec.RecordID]
+	switch match {
+	case "submitted":
+		return rec.Submitted > 0
+	case "notSubmitted":
+		return rec.Submitted == 0
+	case "resolved":
+		return rec.Submitted > 0 && len(states) == 0
+	case "deleted":
+		return rec.Deleted > 0
+	case "actionable":
+		for _, state := range states {
+			st := s.m.steps[state.StepID]
+			if st == nil {
+				continue
+			}
+			for _, dep := range st.Dependencies {
+				if s.m.filled[rec.RecordID][dep] == 0 && s.canAct(rec, st, dep, id) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	for _, state := range states {
+		if strconv.Itoa(state.StepID) == match {
+			return true
+		}
+	}
+	return false
+}
+
+func negate(operator string, found bool) bool {
+	if operator == "!=" {
+		return !found
+	}
+	return found
+}
+
+// compare applies a term's operator. Values compare as numbers when both are
+// numeric, and otherwise case-insensitively like MySQL's general collation.
+// LIKE matches substrings, with * as a wildcard.
+func compare(value string, operator string, match string) (bool, error) {
+	switch strings.ToUpper(operator) {
+	case "LIKE", "NOT LIKE":
+		pattern := strings.ToLower(match)
+		found := true
+		rest := strings.ToLower(value)
+		for _, part := range strings.Split(pattern, "*") {
+			i := strings.Index(rest, part)
+			if i < 0 {
+				found = false
+				break
+			}
+			rest = rest[i+len(part):]
+		}
+		return found == (strings.ToUpper(operator) == "LIKE"), nil
+	}
+
+	cmp := compareValues(value, match)
+
+	switch operator {
+	case "=":
+		return cmp == 0, nil
+	case "!=":
+		return cmp != 0, nil
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	case ">=":
+		return cmp >= 0, nil
+	}
+	return false, fmt.Errorf("leafsim: operator %q is not simulated", operator)
+}
+
+// compareValues compares numerically when both values are numbers
+func compareValues(a string, b string) int {
+	na, errA := strconv.ParseFloat(a, 64)
+	nb, errB := strconv.ParseFloat(b, 64)
+	if errA != nil || errB != nil {
+		return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+	}
+	switch {
+	case na < nb:
+		return -1
+	case na > nb:
+		return 1
+	}
+	return 0
+}
+
+// queryRow builds a record's fields, including the requested joins and data
+func (s *Simulator) queryRow(rec *record, q formQuery, id identity) map[string]any {
+	row := map[string]any{
+		"recordID":        rec.RecordID,
+		"date":            rec.Date,
+		"serviceID":       rec.ServiceID,
+		"userID":          rec.UserID,
+		"title":           rec.Title,
+		"priority":        rec.Priority,
+		"lastStatus":      rec.LastStatus,
+		"submitted":       rec.Submitted,
+		"deleted":         rec.Deleted,
+		"isWritableUser":  rec.IsWritableUser,
+		"isWritableGroup": rec.IsWritableGroup,
+		"userMetadata":    rec.UserMetadata,
+	}
+
+	for _, join := range q.Joins {
+		switch join {
+		case "service":
+			if svc := s.m.services[rec.ServiceID]; svc != nil {
+				row["service"], row["abbreviatedService"], row["groupID"] = svc.Service, svc.AbbreviatedService, svc.GroupID
+			} else {
+				row["service"], row["abbreviatedService"], row["groupID"] = nil, nil, nil
+			}
+		case "status":
+			row["stepID"], row["blockingStepID"], row["lastNotified"], row["stepTitle"] = nil, nil, nil, nil
+			if states := s.m.states[rec.RecordID]; len(states) > 0 {
+				row["stepID"], row["blockingStepID"], row["lastNotified"] = states[0].StepID, states[0].BlockingStepID, states[0].LastNotified
+				if st := s.m.steps[states[0].StepID]; st != nil {
+					row["stepTitle"] = st.StepTitle
+				}
+			}
+		case "categoryName", "categoryNameUnabridged":
+			names := []string{}
+			for _, c := range rec.Categories {
+				if cat := s.m.categories[c]; cat != nil {
+					names = append(names, cat.CategoryName)
+				}
+			}
+			row["categoryNames"] = names
+		case "categoryID":
+			row["categoryIDs"] = append([]string{}, rec.Categories...)
+		case "initiatorName":
+			if p := rec.UserMetadata; p != nil {
+				row["firstName"], row["lastName"], row["userName"] = p.FirstName, p.LastName, p.UserName
+			}
+		case "action_history":
+			row["action_history"] = s.actionHistory(rec)
+		case "unfilledDependencies":
+			row["unfilledDependencyData"] = s.unfilledDependencies(rec)
+		}
+	}
+
+	if len(q.GetData) > 0 {
+		s1 := map[string]any{}
+		for _, v := range q.GetData {
+			indicatorID, err := strconv.Atoi(fmt.Sprint(v))
+			if err != nil {
+				continue
+			}
+			value := ""
+			if d := s.m.getData(rec.RecordID, indicatorID); d != nil {
+				value = d.Value
+			}
+			if ind := s.m.indicators[indicatorID]; ind != nil && ind.IsSensitive == 1 && !id.admin && !sameUser(rec.UserID, id.userID) {
+				value = ""
+			}
+			s1[fmt.Sprintf("id%d", indicatorID)] = value
+		}
+		row["s1"] = s1
+	}
+
+	return row
+}
+
+func (s *Simulator) actionHistory(rec *record) []map[string]any {
+	out := []map[string]any{}
+	for _, h := range s.m.history {
+		if h.RecordID != rec.RecordID {
+			continue
+		}
+		entry := map[string]any{
+			"recordID":            h.RecordID,
+			"stepID":              h.StepID,
+			"userID":              h.UserID,
+			"time":                h.Time,
+			"description":         s.m.dependencies[h.DependencyID],
+			"actionTextPasttense": "",
+			"actionType":          h.ActionType,
+			"comment":             h.Comment,
+			"approverName":        h.UserID,
+			"userMetadata":        h.UserMetadata,
+		}
+		if a := s.m.actions[h.ActionType]; a != nil {
+			entry["actionTextPasttense"] = a.ActionTextPasttense
+		}
+		if h.UserMetadata != nil && h.UserMetadata.name() != "" {
+			entry["approverName"] = h.UserMetadata.name()
+		}
+		out = append(out, entry)
+	}
+	return out
+}
+
+func (s *Simulator) unfilledDependencies(rec *record) map[string]any {
+	out := map[string]any{}
+	for _, state := range s.m.states[rec.RecordID] {
+		st := s.m.steps[state.StepID]
+		if st == nil {
+			continue
+		}
+		for _, dep := range st.Dependencies {
+			if s.m.filled[rec.RecordID][dep] != 0 {
+				continue
+			}
+			entry := map[string]any{"description": s.m.dependencies[dep]}
+			if name, uid, _ := s.approver(rec, st, dep); name != nil {
+				entry["approverName"], entry["approverUID"] = *name, *uid
+			}
+			out[strconv.Itoa(dep)] = entry
+		}
+	}
+	return out
+}
+
+// filterFields keeps the fields listed in x-filterData. "a.b" keeps field b
+// of the entries in a.
+func filterFields(row map[string]any, filter []string) map[string]any {
+	if len(filter) == 0 {
+		return row
+	}
+
+	out := map[string]any{}
+	nested := map[string][]string{}
+	for _, f := range filter {
+		field, sub, isNested := strings.Cut(strings.TrimSpace(f), ".")
+		if v, ok := row[field]; ok {
+			out[field] = v
+		}
+		if isNested {
+			nested[field] = append(nested[field], sub)
+		}
+	}
+
+	for field, subs := range nested {
+		entries, ok := out[field].([]map[string]any)
+		if !ok {
+			continue
+		}
+		filtered := make([]map[string]any, len(entries))
+		for i, e := range entries {
+			filtered[i] = filterFields(e, subs)
+		}
+		out[field] = filtered
+	}
+	return out
+}
@@ -0,0 +1,224 @@
+// Package leafsim is an in-memory stand-in for a LEAF Request Portal. It loads
+// a portal fixture dump and serves the core API endpoints through net/http, so
+// clients such as LEAF_Agent and API scripts can be tested without containers:
+//
+//	sim, err := leafsim.LoadFile("database/portal_test_db.sql", leafsim.Options{})
+//	srv := httptest.NewServer(sim)
+//
+// It implements form/query (terms, joins, getData, sort, limit and
+// x-filterData), form/new, form/{id} and form/{id}/data,
+// formWorkflow/{id}/currentStep and apply, and workflow/step/{id} with its
+// dependencies. POSTs need the session's CSRFToken, which is embedded in the
+// page served at the root like LEAF does, and ?masquerade=nonAdmin drops admin
+// access. Anything else responds 404.
+package leafsim
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UserHeader selects the user for a request, as REMOTE_USER does for a LEAF
+// dev environment. Requests without it act as Options.User.
+const UserHeader = "X-Remote-User"
+
+// SessionCookie holds the session the CSRF token belongs to
+const SessionCookie = "PHPSESSID"
+
+// adminGroupID is LEAF's sysadmin group
+const adminGroupID = 1
+
+type Options struct {
+	// User is the default user, "tester" if empty
+	User string
+
+	// Now returns the time used for new records and actions, time.Now if nil
+	Now func() time.Time
+}
+
+// Simulator serves the LEAF portal API from an in-memory model
+type Simulator struct {
+	opts Options
+
+	mu       sync.Mutex
+	m        *model
+	sessions map[string]string // session ID -> CSRF token
+}
+
+// New loads a portal SQL dump
+func New(dump string, opts Options) (*Simulator, error) {
+	tables, err := ParseDump(dump)
+	if err != nil {
+		return nil, err
+	}
+	m, err := loadModel(tables)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.User == "" {
+		opts.User = "tester"
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+
+	return &Simulator{opts: opts, m: m, sessions: map[string]string{}}, nil
+}
+
+// LoadFile loads a portal SQL dump from a file
+func LoadFile(path string, opts Options) (*Simulator, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return New(string(b), opts)
+}
+
+// identity is the user a request acts as
+type identity struct {
+	userID string
+	admin  bool
+	groups map[int]bool
+}
+
+func (s *Simulator) identity(r *http.Request) identity {
+	userID := r.Header.Get(UserHeader)
+	if userID == "" {
+		userID = s.opts.User
+	}
+
+	groups := map[int]bool{}
+	for g := range s.m.members[strings.ToLower(userID)] {
+		groups[g] = true
+	}
+
+	// Masquerading lets admins see the site as a regular user
+	if r.URL.Query().Get("masquerade") == "nonAdmin" {
+		delete(groups, adminGroupID)
+	}
+
+	return identity{userID: userID, admin: groups[adminGroupID], groups: groups}
+}
+
+func (s *Simulator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := strings.Trim(r.URL.Path, "/")
+	if !strings.HasPrefix(path, "api/") {
+		s.servePage(w, r)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			writeJSON(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if !s.validCSRFToken(r) {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, "Invalid Token.")
+			return
+		}
+	}
+
+	s.route(w, r, strings.Split(strings.TrimPrefix(path, "api/"), "/"))
+}
+
+// servePage starts a session and embeds its CSRF token, like the portal's index page
+func (s *Simulator) servePage(w http.ResponseWriter, r *http.Request) {
+	sessionID := ""
+	if c, err := r.Cookie(SessionCookie); err == nil && s.sessions[c.Value] != "" {
+		sessionID = c.Value
+	} else {
+		sessionID = randomHex(16)
+		s.sessions[sessionID] = randomHex(32)
+		http.SetCookie(w, &http.Cookie{Name: SessionCookie, Value: sessionID, Path: "/", HttpOnly: true, Secure: true, SameSite: http.SameSiteLaxMode})
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	fmt.Fprintf(w, "<!DOCTYPE html>\n<html><head><script>\nvar CSRFToken = '%s';\n</script></head><body>leafsim: %s</body></html>\n",
+		s.sessions[sessionID], s.identity(r).userID)
+}
+
+func (s *Simulator) validCSRFToken(r *http.Request) bool {
+	c, err := r.Cookie(SessionCookie)
+	if err != nil {
+		return false
+	}
+	token, ok := s.sessions[c.Value]
+	return ok && token != "" && r.PostForm.Get("CSRFToken") == token
+}
+
+// route dispatches API requests by path segment
+func (s *Simulator) route(w http.ResponseWriter, r *http.Request, seg []string) {
+	id := s.identity(r)
+
+	switch {
+	case r.Method == http.MethodGet && len(seg) == 2 && seg[0] == "form" && seg[1] == "query":
+		s.formQuery(w, r, id)
+	case r.Method == http.MethodPost && len(seg) == 2 && seg[0] == "form" && seg[1] == "new":
+		s.formNew(w, r, id)
+	case r.Method == http.MethodPost && len(seg) == 2 && seg[0] == "form" && isDigits(seg[1]):
+		s.formWrite(w, r, id, atoi(seg[1]))
+	case r.Method == http.MethodGet && len(seg) == 3 && seg[0] == "form" && isDigits(seg[1]) && seg[2] == "data":
+		s.formData(w, id, atoi(seg[1]))
+	case r.Method == http.MethodGet && len(seg) == 3 && seg[0] == "formWorkflow" && isDigits(seg[1]) && seg[2] == "currentStep":
+		s.currentStep(w, id, atoi(seg[1]))
+	case r.Method == http.MethodPost && len(seg) == 3 && seg[0] == "formWorkflow" && isDigits(seg[1]) && seg[2] == "apply":
+		s.apply(w, r, id, atoi(seg[1]))
+	case r.Method == http.MethodGet && len(seg) == 3 && seg[0] == "workflow" && seg[1] == "step" && isDigits(seg[2]):
+		s.workflowStep(w, atoi(seg[2]))
+	case r.Method == http.MethodGet && len(seg) == 4 && seg[0] == "workflow" && seg[1] == "step" && isDigits(seg[2]) && seg[3] == "dependencies":
+		s.stepDependencies(w, atoi(seg[2]))
+	default:
+		writeJSON(w, http.StatusNotFound, "leafsim: "+r.Method+" api/"+strings.Join(seg, "/")+" is not simulated")
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		status, b = http.StatusInternalServerError, []byte(`"`+err.Error()+`"`)
+	}
+	writeJSONBytes(w, status, b)
+}
+
+func writeJSONBytes(w http.ResponseWriter, status int, b []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func isDigits(s string) bool {
+	if strings.HasPrefix(s, "-") {
+		s = s[1:]
+	}
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func atoi(s string) int {
+	return num(s)
+}
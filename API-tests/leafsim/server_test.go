@@ -0,0 +1,328 @@
+package leafsim
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func loadFixture(t *testing.T) *Simulator {
+	t.Helper()
+
+	sim, err := LoadFile("../database/portal_test_db.sql", Options{
+		Now: func() time.Time { return time.Unix(1704067200, 0) },
+	})
+	if err != nil {
+		t.Fatalf("LoadFile error = %v", err)
+	}
+	return sim
+}
+
+// testSession starts the simulator and a session the way the suite logs in
+type testSession struct {
+	t      *testing.T
+	url    string
+	client *http.Client
+	token  string
+}
+
+func newTestSession(t *testing.T) *testSession {
+	t.Helper()
+
+	srv := httptest.NewServer(loadFixture(t))
+	t.Cleanup(srv.Close)
+
+	jar, _ := cookiejar.New(nil)
+	s := &testSession{t: t, url: srv.URL + "/", client: &http.Client{Jar: jar}}
+
+	body, _ := s.get("")
+	start := strings.Index(body, "var CSRFToken = '") + len("var CSRFToken = '")
+	s.token = body[start : start+strings.Index(body[start:], "'")]
+	if s.token == "" {
+		t.Fatalf("no CSRFToken in the page: %v", body)
+	}
+	return s
+}
+
+func (s *testSession) get(path string) (string, *http.Response) {
+	s.t.Helper()
+
+	res, err := s.client.Get(s.url + path)
+	if err != nil {
+		s.t.Fatalf("GET %s: %v", path, err)
+	}
+	defer res.Body.Close()
+	b, _ := io.ReadAll(res.Body)
+	return string(b), res
+}
+
+func (s *testSession) post(path string, form url.Values) (string, *http.Response) {
+	s.t.Helper()
+
+	res, err := s.client.PostForm(s.url+path, form)
+	if err != nil {
+		s.t.Fatalf("POST %s: %v", path, err)
+	}
+	defer res.Body.Close()
+	b, _ := io.ReadAll(res.Body)
+	return string(b), res
+}
+
+func (s *testSession) query(q string, extra string) map[int]map[string]any {
+	s.t.Helper()
+
+	body, res := s.get("api/form/query?q=" + url.QueryEscape(q) + extra)
+	if res.StatusCode != http.StatusOK {
+		s.t.Fatalf("form/query status = %v, want = %v: %v", res.StatusCode, http.StatusOK, body)
+	}
+	var out map[int]map[string]any
+	if err := json.Unmarshal([]byte(body), &out); err != nil {
+		s.t.Fatalf("form/query response is not JSON: %v", body)
+	}
+	return out
+}
+
+func TestServer_PostRequiresCSRFToken(t *testing.T) {
+	s := newTestSession(t)
+
+	body, res := s.post("api/form/7", url.Values{"3": {"12345"}})
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("missing token status = %v, want = %v", res.StatusCode, http.StatusUnauthorized)
+	}
+	if body != "Invalid Token." {
+		t.Errorf("missing token body = %v, want = %v", body, "Invalid Token.")
+	}
+
+	_, res = s.post("api/form/7", url.Values{"CSRFToken": {"not the token"}, "3": {"12345"}})
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("wrong token status = %v, want = %v", res.StatusCode, http.StatusUnauthorized)
+	}
+
+	// A token from another session isn't accepted either
+	other := newTestSession(t)
+	other.url = s.url
+	_, res = other.post("api/form/7", url.Values{"CSRFToken": {s.token}, "3": {"12345"}})
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("other session's token status = %v, want = %v", res.StatusCode, http.StatusUnauthorized)
+	}
+
+	_, res = s.post("api/form/7", url.Values{"CSRFToken": {s.token}, "3": {"12345"}})
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("valid token status = %v, want = %v", res.StatusCode, http.StatusOK)
+	}
+}
+
+func TestServer_FormQuery(t *testing.T) {
+	s := newTestSession(t)
+
+	res := s.query(`{"terms":[{"id":"userID","operator":"=","match":"vtrshhzofia","gate":"AND"},{"id":"deleted","operator":"=","match":0,"gate":"AND"}],"joins":["service","status","categoryName"],"sort":{"column":"recordID","direction":"DESC"},"limit":50}`, "")
+	if _, exists := res[6]; !exists {
+		t.Errorf("record 6 should match a case insensitive userID. got = %v", getKeys(res))
+	}
+
+	res = s.query(`{"terms":[{"id":"stepID","operator":"=","match":"3","gate":"AND"},{"id":"stepID","operator":"=","match":"-3","gate":"OR"},{"id":"deleted","operator":"=","match":0,"gate":"AND"}],"joins":[],"sort":{}}`, "&x-filterData=recordID,stepID")
+	if len(res) == 0 {
+		t.Errorf("no records on step 3 or -3, want = some")
+	}
+	for recordID, rec := range res {
+		if !cmp.Equal(getKeys(rec), []string{"recordID"}) {
+			t.Errorf("record %v fields = %v, want = x-filterData fields that were joined", recordID, getKeys(rec))
+			break
+		}
+	}
+
+	res = s.query(`{"terms":[{"id":"recordID","operator":"=","match":"484","gate":"AND"}],"joins":["status","unfilledDependencies"],"sort":{}}`, "&x-filterData=recordID,stepTitle,unfilledDependencyData")
+	deps, _ := res[484]["unfilledDependencyData"].(map[string]any)
+	if got, want := getKeys(deps), []string{"-1", "9"}; !cmp.Equal(got, want) {
+		t.Errorf("record 484 unfilled dependencies = %v, want = %v", got, want)
+	}
+	if got, want := res[484]["stepTitle"], "Step 1"; got != want {
+		t.Errorf("record 484 stepTitle = %v, want = %v", got, want)
+	}
+}
+
+func TestServer_FormQuery_NeedToKnow(t *testing.T) {
+	s := newTestSession(t)
+
+	q := `{"terms":[{"id":"recordID","operator":"=","match":"505","gate":"AND"}],"joins":[],"sort":{}}`
+	if res := s.query(q, ""); len(res) != 1 {
+		t.Errorf("admin sees %v records, want = 1", len(res))
+	}
+	if res := s.query(q, "&masquerade=nonAdmin"); len(res) != 0 {
+		t.Errorf("non-admin sees %v need to know records of other users, want = 0", len(res))
+	}
+}
+
+func TestServer_FormAccess(t *testing.T) {
+	s := newTestSession(t)
+
+	body, res := s.post("api/form/505?masquerade=nonAdmin", url.Values{"CSRFToken": {s.token}, "3": {"12345"}})
+	if res.StatusCode != http.StatusUnauthorized || body != `"No write access (data field)"` {
+		t.Errorf("non-admin write got = %v %v, want = %v %v", res.StatusCode, body, http.StatusUnauthorized, `"No write access (data field)"`)
+	}
+
+	body, _ = s.get("api/form/505/data?masquerade=nonAdmin")
+	if body != `[]` {
+		t.Errorf("non-admin read of a need to know record got = %v, want = []", body)
+	}
+
+	body, _ = s.post("api/form/7?masquerade=nonAdmin", url.Values{"CSRFToken": {s.token}, "3": {"12345"}})
+	if body != `"1"` {
+		t.Errorf("initiator write with a differently cased userID got = %v, want = %v", body, `"1"`)
+	}
+}
+
+func TestServer_FormNew(t *testing.T) {
+	s := newTestSession(t)
+
+	body, res := s.post("api/form/new", url.Values{
+		"CSRFToken":     {s.token},
+		"numform_5ea07": {"1"},
+		"title":         {"TestServer_FormNew"},
+		"3":             {"some text"},
+	})
+	var recordID string
+	if err := json.Unmarshal([]byte(body), &recordID); err != nil || res.StatusCode != http.StatusOK {
+		t.Fatalf("form/new got = %v %v, want = 200 and a recordID", res.StatusCode, body)
+	}
+
+	out := s.query(`{"terms":[{"id":"recordID","operator":"=","match":"`+recordID+`","gate":"AND"}],"joins":["categoryName"],"sort":{},"getData":["3"]}`, "")
+	for _, rec := range out {
+		if got, want := rec["title"], "TestServer_FormNew"; got != want {
+			t.Errorf("title = %v, want = %v", got, want)
+		}
+		if got, want := rec["s1"], map[string]any{"id3": "some text"}; !cmp.Equal(got, want) {
+			t.Errorf("s1 = %v, want = %v", got, want)
+		}
+		if got, want := rec["categoryNames"], []any{"General Form"}; !cmp.Equal(got, want) {
+			t.Errorf("categoryNames = %v, want = %v", got, want)
+		}
+		return
+	}
+	t.Errorf("record %v not found by form/query", recordID)
+}
+
+func TestServer_CurrentStep(t *testing.T) {
+	s := newTestSession(t)
+
+	var res map[int]struct {
+		Description  string  `json:"description"`
+		ApproverName *string `json:"approverName"`
+		UserMetadata Person  `json:"userMetadata"`
+	}
+
+	body, _ := s.get("api/formWorkflow/484/currentStep")
+	json.Unmarshal([]byte(body), &res)
+	if got, want := res[9].Description, "Group A"; got != want {
+		t.Errorf("dependency 9 description = %v, want = %v", got, want)
+	}
+	if got, want := res[-1].Description, "Step 1 (Omar Marvin)"; got != want {
+		t.Errorf("dependency -1 description = %v, want = %v", got, want)
+	}
+	if res[9].ApproverName != nil {
+		t.Errorf("dependency 9 approverName = %v, want = nil", *res[9].ApproverName)
+	}
+
+	res = nil
+	body, _ = s.get("api/formWorkflow/530/currentStep?masquerade=nonAdmin")
+	json.Unmarshal([]byte(body), &res)
+	if res[-2].ApproverName == nil || *res[-2].ApproverName != "Alysa Dare" {
+		t.Errorf("dependency -2 approverName = %v, want = Alysa Dare", res[-2].ApproverName)
+	}
+	if got, want := res[-2].UserMetadata.Email, "Alysa.Dare@fake-email.com"; got != want {
+		t.Errorf("dependency -2 userMetadata.email = %v, want = %v", got, want)
+	}
+}
+
+func TestServer_ApplyAction(t *testing.T) {
+	s := newTestSession(t)
+
+	tests := []struct {
+		name   string
+		record string
+		form   url.Values
+		want   int
+	}{
+		{"invalid ID", "8", url.Values{"dependencyID": {"invalid id"}, "actionType": {"approve"}}, http.StatusBadRequest},
+		{"invalid action", "8", url.Values{"dependencyID": {"-3"}, "actionType": {"invalidAction"}}, http.StatusBadRequest},
+		{"valid ID", "8", url.Values{"dependencyID": {"-3"}, "actionType": {"approve"}}, http.StatusOK},
+		{"page is out of date", "8", url.Values{"dependencyID": {"-3"}, "actionType": {"approve"}}, http.StatusConflict},
+		{"valid action with stepID", "504", url.Values{"dependencyID": {"-2"}, "stepID": {"3"}, "actionType": {"Note"}}, http.StatusOK},
+		{"wrong stepID", "504", url.Values{"dependencyID": {"-2"}, "stepID": {"1"}, "actionType": {"Note"}}, http.StatusConflict},
+		{"first of duplicate actions", "496", url.Values{"dependencyID": {"-1"}, "stepID": {"1"}, "actionType": {"approve"}}, http.StatusOK},
+		{"duplicate action", "496", url.Values{"dependencyID": {"-1"}, "stepID": {"1"}, "actionType": {"approve"}}, http.StatusAccepted},
+	}
+
+	// Cases run in order, since each one changes the records' state
+	for _, tc := range tests {
+		tc.form.Set("CSRFToken", s.token)
+		body, res := s.post("api/formWorkflow/"+tc.record+"/apply", tc.form)
+		if res.StatusCode != tc.want {
+			t.Errorf("%s: status = %v, want = %v: %v", tc.name, res.StatusCode, tc.want, body)
+		}
+	}
+
+	// Record 8 finished its workflow
+	out := s.query(`{"terms":[{"id":"recordID","operator":"=","match":"8","gate":"AND"},{"id":"stepID","operator":"=","match":"resolved","gate":"AND"}],"joins":["action_history"],"sort":{}}`, "&x-filterData=recordID,lastStatus,action_history.actionType")
+	if got, want := out[8]["lastStatus"], "Approved"; got != want {
+		t.Errorf("record 8 lastStatus = %v, want = %v", got, want)
+	}
+	history, _ := out[8]["action_history"].([]any)
+	if len(history) == 0 || !cmp.Equal(history[len(history)-1], map[string]any{"actionType": "approve"}) {
+		t.Errorf("record 8 action_history = %v, want = approve last", history)
+	}
+}
+
+func TestServer_WorkflowStepDependencies(t *testing.T) {
+	s := newTestSession(t)
+
+	body, _ := s.get("api/workflow/step/2/dependencies")
+	var deps []stepDependency
+	if err := json.Unmarshal([]byte(body), &deps); err != nil {
+		t.Fatalf("response is not JSON: %v", body)
+	}
+	if len(deps) != 1 || deps[0].DependencyID != 9 || deps[0].Name == nil || *deps[0].Name != "Group A" {
+		t.Errorf("step 2 dependencies = %v, want = dependency 9 assigned to Group A", body)
+	}
+
+	body, _ = s.get("api/workflow/step/2")
+	var st struct {
+		StepTitle  string `json:"stepTitle"`
+		WorkflowID int    `json:"workflowID"`
+	}
+	json.Unmarshal([]byte(body), &st)
+	if st.StepTitle != "Step 2" || st.WorkflowID != 1 {
+		t.Errorf("step 2 = %v, want = Step 2 in workflow 1", body)
+	}
+}
+
+func TestServer_UnsimulatedEndpoint(t *testing.T) {
+	s := newTestSession(t)
+
+	_, res := s.get("api/system/settings")
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("status = %v, want = %v", res.StatusCode, http.StatusNotFound)
+	}
+}
+
+// getKeys returns a map's keys in sorted order
+func getKeys[K int | string, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	for i := 1; i < len(keys); i++ {
+		for j := i; j > 0 && keys[j] < keys[j-1]; j-- {
+			keys[j], keys[j-1] = keys[j-1], keys[j]
+		}
+	}
+	return keys
+}
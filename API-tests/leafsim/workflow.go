@@ -0,0 +1,345 @@
+package leafsim
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+type stepAction struct {
+	ActionType          string `json:"actionType"`
+	WorkflowID          int    `json:"workflowID"`
+	StepID              int    `json:"stepID"`
+	NextStepID          int    `json:"nextStepID"`
+	DisplayConditional  string `json:"displayConditional"`
+	ActionText          string `json:"actionText"`
+	ActionTextPasttense string `json:"actionTextPasttense"`
+	ActionIcon          string `json:"actionIcon"`
+	ActionAlignment     string `json:"actionAlignment"`
+	Sort                int    `json:"sort"`
+	FillDependency      int    `json:"fillDependency"`
+	Deleted             int    `json:"deleted"`
+}
+
+type currentDependency struct {
+	DependencyID                  int          `json:"dependencyID"`
+	RecordID                      int          `json:"recordID"`
+	StepID                        int          `json:"stepID"`
+	StepTitle                     string       `json:"stepTitle"`
+	BlockingStepID                int          `json:"blockingStepID"`
+	WorkflowID                    int          `json:"workflowID"`
+	ServiceID                     int          `json:"serviceID"`
+	Filled                        int          `json:"filled"`
+	StepBgColor                   string       `json:"stepBgColor"`
+	StepFontColor                 string       `json:"stepFontColor"`
+	StepBorder                    string       `json:"stepBorder"`
+	Description                   string       `json:"description"`
+	IndicatorIDForAssignedEmpUID  int          `json:"indicatorID_for_assigned_empUID"`
+	IndicatorIDForAssignedGroupID int          `json:"indicatorID_for_assigned_groupID"`
+	JsSrc                         string       `json:"jsSrc"`
+	UserID                        string       `json:"userID"`
+	UserMetadata                  *Person      `json:"userMetadata"`
+	RequiresDigitalSignature      bool         `json:"requiresDigitalSignature"`
+	IsActionable                  bool         `json:"isActionable"`
+	ApproverName                  *string      `json:"approverName,omitempty"`
+	ApproverUID                   *string      `json:"approverUID,omitempty"`
+	DependencyActions             []stepAction `json:"dependencyActions"`
+	HasAccess                     bool         `json:"hasAccess"`
+}
+
+// stepActions lists the actions available on a step
+func (s *Simulator) stepActions(st *step) []stepAction {
+	actions := []stepAction{}
+	for _, rt := range s.m.routes {
+		a := s.m.actions[rt.ActionType]
+		if rt.WorkflowID != st.WorkflowID || rt.StepID != st.StepID || a == nil {
+			continue
+		}
+		actions = append(actions, stepAction{
+			ActionType:          a.ActionType,
+			WorkflowID:          rt.WorkflowID,
+			StepID:              rt.StepID,
+			NextStepID:          rt.NextStepID,
+			DisplayConditional:  rt.DisplayConditional,
+			ActionText:          a.ActionText,
+			ActionTextPasttense: a.ActionTextPasttense,
+			ActionIcon:          a.ActionIcon,
+			ActionAlignment:     a.ActionAlignment,
+			Sort:                a.Sort,
+			FillDependency:      a.FillDependency,
+			Deleted:             a.Deleted,
+		})
+	}
+	sort.SliceStable(actions, func(i, j int) bool {
+		if actions[i].Sort != actions[j].Sort {
+			return actions[i].Sort < actions[j].Sort
+		}
+		return actions[i].ActionType < actions[j].ActionType
+	})
+	return actions
+}
+
+// currentStep lists the dependencies of a record's current steps by dependencyID
+func (s *Simulator) currentStep(w http.ResponseWriter, id identity, recordID int) {
+	rec := s.m.records[recordID]
+	if rec == nil || !s.canRead(rec, id) {
+		writeJSONBytes(w, http.StatusOK, []byte(`[]`))
+		return
+	}
+
+	out := map[int]currentDependency{}
+	for _, state := range s.m.states[recordID] {
+		st := s.m.steps[state.StepID]
+		if st == nil {
+			continue
+		}
+		for _, dep := range st.Dependencies {
+			name, uid, _ := s.approver(rec, st, dep)
+			actionable := s.canAct(rec, st, dep, id)
+
+			// Designated approvers are described by step and assignee
+			description := s.m.dependencies[dep]
+			if name != nil && (dep == depPersonDesignated || dep == depGroupDesignated) {
+				description = st.StepTitle + " (" + *name + ")"
+			}
+			out[dep] = currentDependency{
+				DependencyID:                  dep,
+				RecordID:                      recordID,
+				StepID:                        st.StepID,
+				StepTitle:                     st.StepTitle,
+				BlockingStepID:                state.BlockingStepID,
+				WorkflowID:                    st.WorkflowID,
+				ServiceID:                     rec.ServiceID,
+				Filled:                        s.m.filled[recordID][dep],
+				StepBgColor:                   st.StepBgColor,
+				StepFontColor:                 st.StepFontColor,
+				StepBorder:                    st.StepBorder,
+				Description:                   description,
+				IndicatorIDForAssignedEmpUID:  st.IndicatorIDForAssignedEmpUID,
+				IndicatorIDForAssignedGroupID: st.IndicatorIDForAssignedGroupID,
+				JsSrc:                         st.JsSrc,
+				UserID:                        rec.UserID,
+				UserMetadata:                  s.initiator(rec, st, dep),
+				RequiresDigitalSignature:      st.RequiresDigitalSignature == 1,
+				IsActionable:                  actionable,
+				ApproverName:                  name,
+				ApproverUID:                   uid,
+				DependencyActions:             s.stepActions(st),
+				HasAccess:                     actionable,
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// initiator is the person shown with a dependency: the requestor for
+// requestor followup, the initiator otherwise
+func (s *Simulator) initiator(rec *record, st *step, dep int) *Person {
+	if dep == depRequestor {
+		if _, _, who := s.approver(rec, st, dep); who != nil {
+			return who
+		}
+	}
+	return rec.UserMetadata
+}
+
+type applyResult struct {
+	Status int      `json:"status"`
+	Errors []string `json:"errors"`
+}
+
+// apply takes an action on one of a record's current dependencies. It responds
+// 400 for invalid input, 409 when the record isn't on that step or dependency
+// anymore, and 202 when the same action was just taken.
+func (s *Simulator) apply(w http.ResponseWriter, r *http.Request, id identity, recordID int) {
+	rec := s.m.records[recordID]
+	if rec == nil {
+		writeJSON(w, http.StatusBadRequest, "Invalid record")
+		return
+	}
+
+	dependencyID, err := strconv.Atoi(r.PostForm.Get("dependencyID"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+	actionType := r.PostForm.Get("actionType")
+	act := s.m.actions[actionType]
+	if act == nil || act.Deleted != 0 {
+		writeJSON(w, http.StatusBadRequest, "Invalid action")
+		return
+	}
+
+	wantStep, hasStep := 0, r.PostForm.Get("stepID") != ""
+	if hasStep {
+		wantStep = atoi(r.PostForm.Get("stepID"))
+	}
+
+	var state *workflowState
+	var st *step
+	for _, ws := range s.m.states[recordID] {
+		candidate := s.m.steps[ws.StepID]
+		if candidate == nil || (hasStep && ws.StepID != wantStep) {
+			continue
+		}
+		for _, dep := range candidate.Dependencies {
+			if dep == dependencyID {
+				state, st = ws, candidate
+			}
+		}
+	}
+	if st == nil {
+		writeJSON(w, http.StatusConflict, "This page is out of date. Please refresh for the latest status.")
+		return
+	}
+
+	var rt *route
+	for i := range s.m.routes {
+		if s.m.routes[i].WorkflowID == st.WorkflowID && s.m.routes[i].StepID == st.StepID && s.m.routes[i].ActionType == actionType {
+			rt = &s.m.routes[i]
+		}
+	}
+	if rt == nil {
+		writeJSON(w, http.StatusBadRequest, "Invalid action")
+		return
+	}
+
+	if !s.canAct(rec, st, dependencyID, id) {
+		writeJSON(w, http.StatusUnauthorized, "Error: Access denied")
+		return
+	}
+
+	if s.m.filled[recordID][dependencyID] != 0 && s.lastAction(recordID, st.StepID, dependencyID) == actionType {
+		writeJSON(w, http.StatusAccepted, "Duplicate action")
+		return
+	}
+
+	s.m.history = append(s.m.history, &actionHistory{
+		RecordID:     recordID,
+		UserID:       id.userID,
+		StepID:       st.StepID,
+		DependencyID: dependencyID,
+		ActionType:   actionType,
+		Time:         int(s.opts.Now().Unix()),
+		Comment:      r.PostForm.Get("comment"),
+		UserMetadata: &Person{UserName: id.userID},
+	})
+	s.m.setFilled(recordID, dependencyID, act.FillDependency)
+
+	// A step moves on once all its dependencies are filled, or right away for
+	// actions that don't fill a dependency, such as sendback
+	if act.FillDependency > 0 {
+		for _, dep := range st.Dependencies {
+			if s.m.filled[recordID][dep] <= 0 {
+				writeJSON(w, http.StatusOK, applyResult{Status: 1, Errors: []string{}})
+				return
+			}
+		}
+	}
+	s.moveRecord(rec, state, rt.NextStepID, act)
+
+	writeJSON(w, http.StatusOK, applyResult{Status: 1, Errors: []string{}})
+}
+
+func (s *Simulator) lastAction(recordID int, stepID int, dependencyID int) string {
+	for i := len(s.m.history) - 1; i >= 0; i-- {
+		h := s.m.history[i]
+		if h.RecordID == recordID && h.StepID == stepID && h.DependencyID == dependencyID {
+			return h.ActionType
+		}
+	}
+	return ""
+}
+
+// moveRecord replaces a record's current step with nextStepID. Step 0 ends the workflow.
+func (s *Simulator) moveRecord(rec *record, from *workflowState, nextStepID int, act *action) {
+	var states []*workflowState
+	for _, ws := range s.m.states[rec.RecordID] {
+		if ws != from {
+			states = append(states, ws)
+		}
+	}
+
+	if act.ActionType == "sendback" {
+		states = nil
+		rec.Submitted = 0
+		rec.IsWritableUser = 1
+	} else if next := s.m.steps[nextStepID]; next != nil {
+		states = append(states, &workflowState{StepID: nextStepID})
+		for _, dep := range next.Dependencies {
+			s.m.setFilled(rec.RecordID, dep, 0)
+		}
+	}
+
+	s.m.states[rec.RecordID] = states
+	rec.LastStatus = act.ActionTextPasttense
+}
+
+// workflowStep returns a step's configuration, or null if it doesn't exist
+func (s *Simulator) workflowStep(w http.ResponseWriter, stepID int) {
+	st := s.m.steps[stepID]
+	if st == nil {
+		writeJSON(w, http.StatusOK, nil)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"workflowID":                       st.WorkflowID,
+		"stepID":                           st.StepID,
+		"stepTitle":                        st.StepTitle,
+		"stepBgColor":                      st.StepBgColor,
+		"stepFontColor":                    st.StepFontColor,
+		"stepBorder":                       st.StepBorder,
+		"jsSrc":                            st.JsSrc,
+		"posX":                             st.PosX,
+		"posY":                             st.PosY,
+		"indicatorID_for_assigned_empUID":  st.IndicatorIDForAssignedEmpUID,
+		"indicatorID_for_assigned_groupID": st.IndicatorIDForAssignedGroupID,
+		"requiresDigitalSignature":         st.RequiresDigitalSignature,
+		"stepData":                         st.StepData,
+	})
+}
+
+type stepDependency struct {
+	DependencyID                  int     `json:"dependencyID"`
+	Description                   string  `json:"description"`
+	WorkflowID                    int     `json:"workflowID"`
+	StepID                        int     `json:"stepID"`
+	StepTitle                     string  `json:"stepTitle"`
+	GroupID                       *int    `json:"groupID"`
+	Name                          *string `json:"name"`
+	IndicatorIDForAssignedEmpUID  int     `json:"indicatorID_for_assigned_empUID"`
+	IndicatorIDForAssignedGroupID int     `json:"indicatorID_for_assigned_groupID"`
+}
+
+// stepDependencies lists a step's dependencies, once per group assigned to each
+func (s *Simulator) stepDependencies(w http.ResponseWriter, stepID int) {
+	out := []stepDependency{}
+	st := s.m.steps[stepID]
+	if st == nil {
+		writeJSON(w, http.StatusOK, out)
+		return
+	}
+
+	for _, dep := range st.Dependencies {
+		d := stepDependency{
+			DependencyID:                  dep,
+			Description:                   s.m.dependencies[dep],
+			WorkflowID:                    st.WorkflowID,
+			StepID:                        st.StepID,
+			StepTitle:                     st.StepTitle,
+			IndicatorIDForAssignedEmpUID:  st.IndicatorIDForAssignedEmpUID,
+			IndicatorIDForAssignedGroupID: st.IndicatorIDForAssignedGroupID,
+		}
+		if len(s.m.depGroups[dep]) == 0 {
+			out = append(out, d)
+			continue
+		}
+		for _, g := range s.m.depGroups[dep] {
+			groupID, name := g, s.m.groups[g]
+			d.GroupID, d.Name = &groupID, &name
+			out = append(out, d)
+		}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
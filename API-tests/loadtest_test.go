@@ -0,0 +1,369 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"text/tabwriter"
+	"time"
+)
+
+// TestLoad runs concurrent virtual users against the test portal and reports
+// throughput, error rate and latency percentiles per endpoint. It only runs
+// when -load.users is set:
+//
+//	go test -run="^TestLoad$" -load.users=50 -load.duration=2m
+var loadUsers = flag.Int("load.users", 0, "number of concurrent virtual users for TestLoad (0 skips the load test)")
+var loadDuration = flag.Duration("load.duration", time.Minute, "how long TestLoad runs")
+var loadRampUp = flag.Duration("load.rampup", 10*time.Second, "time over which virtual users are started")
+var loadThinkTime = flag.Duration("load.think", 2*time.Second, "average pause between a virtual user's scenarios")
+var loadMix = flag.String("load.mix", "homepage=4,inbox=4,viewRecord=3,applyAction=1", "relative weight of each scenario")
+
+const (
+	loadHomepageQuery = `api/form/query?q={"terms":[{"id":"title","operator":"LIKE","match":"***","gate":"AND"},{"id":"deleted","operator":"=","match":0,"gate":"AND"}],"joins":["service","status","categoryName"],"sort":{"column":"date","direction":"DESC"},"limit":50}`
+	loadInboxQuery    = `api/form/query/?q={"terms":[{"id":"stepID","operator":"=","match":"actionable","gate":"AND"},{"id":"deleted","operator":"=","match":0,"gate":"AND"}],"joins":["service","categoryName","status","unfilledDependencies"],"sort":{},"limit":1000,"limitOffset":0}&x-filterData=recordID,categoryIDs,categoryNames,date,title,service,submitted,priority,stepID,blockingStepID,lastStatus,stepTitle,action_history.time,unfilledDependencyData`
+	loadRecordsQuery  = `api/form/query?q={"terms":[{"id":"deleted","operator":"=","match":0,"gate":"AND"}],"joins":[],"sort":{},"limit":1000}&x-filterData=recordID`
+)
+
+// loadScenario is one thing a user does, made up of one or more requests
+type loadScenario struct {
+	name   string
+	weight int
+	run    func(vu *virtualUser)
+}
+
+var loadScenarios = []loadScenario{
+	{name: "homepage", run: func(vu *virtualUser) {
+		vu.get("homepage query", loadHomepageQuery)
+	}},
+	{name: "inbox", run: func(vu *virtualUser) {
+		vu.get("inbox query", loadInboxQuery)
+	}},
+	{name: "viewRecord", run: func(vu *virtualUser) {
+		recordID := vu.pick(vu.load.records)
+		if recordID == 0 {
+			return
+		}
+		vu.get("form data", "api/form/"+strconv.Itoa(recordID)+"/data")
+		vu.get("form workflow currentStep", "api/formWorkflow/"+strconv.Itoa(recordID)+"/currentStep")
+	}},
+	{name: "applyAction", run: func(vu *virtualUser) {
+		// Only admins have a pool of actionable records to work through
+		if vu.persona != "admin" {
+			vu.get("inbox query", loadInboxQuery)
+			return
+		}
+		recordID := vu.pick(vu.load.actionable)
+		if recordID == 0 {
+			return
+		}
+
+		body, ok := vu.get("form workflow currentStep", "api/formWorkflow/"+strconv.Itoa(recordID)+"/currentStep")
+		if !ok {
+			return
+		}
+		var steps FormWorkflowResponse
+		if json.Unmarshal([]byte(body), &steps) != nil {
+			return
+		}
+
+		for _, dep := range steps {
+			if !dep.IsActionable || len(dep.DependencyActions) == 0 {
+				continue
+			}
+
+			// Prefer actions that keep the record on the same step, so it stays in the pool
+			action := dep.DependencyActions[0]
+			for _, a := range dep.DependencyActions {
+				if a.NextStepID == dep.StepID {
+					action = a
+					break
+				}
+			}
+
+			postData := url.Values{}
+			postData.Set("CSRFToken", vu.csrfToken)
+			postData.Set("dependencyID", strconv.Itoa(dep.DependencyID))
+			postData.Set("stepID", strconv.Itoa(dep.StepID))
+			postData.Set("actionType", action.ActionType)
+			postData.Set("comment", "load test")
+			vu.post("form workflow apply", "api/formWorkflow/"+strconv.Itoa(recordID)+"/apply", postData)
+			return
+		}
+	}},
+}
+
+// loadStats collects latencies and errors per endpoint
+type loadStats struct {
+	mu        sync.Mutex
+	latencies map[string][]time.Duration
+	errors    map[string]int
+}
+
+func (s *loadStats) record(endpoint string, latency time.Duration, failed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.latencies[endpoint] = append(s.latencies[endpoint], latency)
+	if failed {
+		s.errors[endpoint]++
+	}
+}
+
+// loadRun is the state shared by all virtual users
+type loadRun struct {
+	stats      *loadStats
+	records    []int
+	actionable []int
+}
+
+type virtualUser struct {
+	load      *loadRun
+	client    *http.Client
+	persona   string
+	csrfToken string
+	rnd       *rand.Rand
+}
+
+// newVirtualUser logs in with its own session. Its client sends on baseTransport
+// rather than suiteTransport, so the transcript, cassette and other observers
+// don't add to the measured latency.
+func newVirtualUser(load *loadRun, persona string, seed int64) (*virtualUser, error) {
+	jar, _ := cookiejar.New(nil)
+	vu := &virtualUser{
+		load: load,
+		client: &http.Client{
+			Transport: baseRoundTripper{},
+			Timeout:   time.Minute,
+			Jar:       jar,
+		},
+		persona: persona,
+		rnd:     rand.New(rand.NewSource(seed)),
+	}
+
+	res, err := vu.client.Get(RootURL)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	vu.csrfToken = readCSRFToken(string(body))
+
+	return vu, nil
+}
+
+// withPersona adds the masquerade parameter for non-admin users
+func (vu *virtualUser) withPersona(path string) string {
+	if vu.persona != "nonAdmin" {
+		return RootURL + path
+	}
+	if strings.Contains(path, "?") {
+		return RootURL + path + "&masquerade=nonAdmin"
+	}
+	return RootURL + path + "?masquerade=nonAdmin"
+}
+
+func (vu *virtualUser) get(endpoint string, path string) (string, bool) {
+	req, _ := http.NewRequest("GET", strings.ReplaceAll(vu.withPersona(path), " ", "%20"), nil)
+	return vu.do(endpoint, req)
+}
+
+func (vu *virtualUser) post(endpoint string, path string, data url.Values) (string, bool) {
+	req, _ := http.NewRequest("POST", vu.withPersona(path), strings.NewReader(data.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return vu.do(endpoint, req)
+}
+
+// do sends a request and records its latency. 409 Conflict is expected when
+// several users act on the same record, so it isn't counted as an error.
+func (vu *virtualUser) do(endpoint string, req *http.Request) (string, bool) {
+	start := time.Now()
+	res, err := vu.client.Do(req)
+	if err != nil {
+		vu.load.stats.record(endpoint, time.Since(start), true)
+		return "", false
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	latency := time.Since(start)
+	failed := err != nil || (res.StatusCode >= 400 && res.StatusCode != http.StatusConflict)
+	vu.load.stats.record(endpoint, latency, failed)
+
+	return string(body), !failed
+}
+
+func (vu *virtualUser) pick(pool []int) int {
+	if len(pool) == 0 {
+		return 0
+	}
+	return pool[vu.rnd.Intn(len(pool))]
+}
+
+// think pauses for 50-150% of the configured think time
+func (vu *virtualUser) think() time.Duration {
+	return time.Duration(float64(*loadThinkTime) * (0.5 + vu.rnd.Float64()))
+}
+
+// parseLoadMix applies weights such as "homepage=4,inbox=4" to loadScenarios
+func parseLoadMix(mix string) ([]loadScenario, error) {
+	weights := map[string]int{}
+	for _, part := range strings.Split(mix, ",") {
+		name, weight, found := strings.Cut(strings.TrimSpace(part), "=")
+		w, err := strconv.Atoi(weight)
+		if !found || err != nil || w < 0 {
+			return nil, fmt.Errorf("invalid scenario weight %q, want name=weight", part)
+		}
+		weights[name] = w
+	}
+
+	var scenarios []loadScenario
+	for _, s := range loadScenarios {
+		if w, ok := weights[s.name]; ok {
+			s.weight = w
+			delete(weights, s.name)
+			if w > 0 {
+				scenarios = append(scenarios, s)
+			}
+		}
+	}
+	if len(weights) > 0 {
+		unknown := make([]string, 0, len(weights))
+		for name := range weights {
+			unknown = append(unknown, name)
+		}
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown scenario(s) %s", strings.Join(unknown, ", "))
+	}
+	if len(scenarios) == 0 {
+		return nil, fmt.Errorf("no scenarios selected")
+	}
+
+	return scenarios, nil
+}
+
+func pickScenario(rnd *rand.Rand, scenarios []loadScenario) loadScenario {
+	total := 0
+	for _, s := range scenarios {
+		total += s.weight
+	}
+	n := rnd.Intn(total)
+	for _, s := range scenarios {
+		if n < s.weight {
+			return s
+		}
+		n -= s.weight
+	}
+	return scenarios[len(scenarios)-1]
+}
+
+// loadRecordIDs returns the recordIDs matched by a form query
+func loadRecordIDs(path string) []int {
+	res, _ := httpGet(RootURL + path)
+
+	var records FormQueryResponse
+	json.Unmarshal([]byte(res), &records)
+
+	ids := make([]int, 0, len(records))
+	for id := range records {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// percentile returns the p-th percentile of sorted latencies using the nearest-rank method
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(rank-1, 0)]
+}
+
+func TestLoad(t *testing.T) {
+	if *loadUsers <= 0 {
+		t.Skip("set -load.users to run the load test")
+	}
+
+	scenarios, err := parseLoadMix(*loadMix)
+	if err != nil {
+		t.Fatalf("-load.mix: %v", err)
+	}
+
+	load := &loadRun{
+		stats:      &loadStats{latencies: map[string][]time.Duration{}, errors: map[string]int{}},
+		records:    loadRecordIDs(loadRecordsQuery),
+		actionable: loadRecordIDs(loadInboxQuery),
+	}
+
+	start := time.Now()
+	deadline := start.Add(*loadDuration)
+	var wg sync.WaitGroup
+	for i := 0; i < *loadUsers; i++ {
+		// Alternate personas so both admin and non-admin queries are exercised
+		persona := "admin"
+		if i%2 == 1 {
+			persona = "nonAdmin"
+		}
+
+		wg.Add(1)
+		go func(i int, persona string) {
+			defer wg.Done()
+
+			time.Sleep(*loadRampUp * time.Duration(i) / time.Duration(*loadUsers))
+			vu, err := newVirtualUser(load, persona, *recordSeed+int64(i))
+			if err != nil {
+				load.stats.record("login", 0, true)
+				return
+			}
+
+			for time.Now().Before(deadline) {
+				pickScenario(vu.rnd, scenarios).run(vu)
+				time.Sleep(vu.think())
+			}
+		}(i, persona)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	endpoints := make([]string, 0, len(load.stats.latencies))
+	for endpoint := range load.stats.latencies {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Strings(endpoints)
+
+	fmt.Printf("\nLoad test: %d virtual users for %v (think time %v, mix %s)\n", *loadUsers, elapsed.Round(time.Second), *loadThinkTime, *loadMix)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "endpoint\trequests\treq/s\terrors\tp50\tp95\tp99\t")
+	for _, endpoint := range endpoints {
+		latencies := load.stats.latencies[endpoint]
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		errorRate := 100 * float64(load.stats.errors[endpoint]) / float64(len(latencies))
+
+		fmt.Fprintf(w, "%s\t%d\t%.2f\t%.1f%%\t%v\t%v\t%v\t\n",
+			endpoint,
+			len(latencies),
+			float64(len(latencies))/elapsed.Seconds(),
+			errorRate,
+			percentile(latencies, 50).Round(time.Millisecond),
+			percentile(latencies, 95).Round(time.Millisecond),
+			percentile(latencies, 99).Round(time.Millisecond))
+	}
+	w.Flush()
+}
@@ -11,7 +11,7 @@ import (
 
 func TestLogin_DeactivatedLocalUser(t *testing.T) {
 	// Setup database connection
-	db, err := sql.Open("mysql", mysqlDSN)
+	db, err := sql.Open(dbDriver, mysqlDSN)
 	if err != nil {
 		log.Fatal("Couldn't open database, check DSN: ", err.Error())
 	}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"crypto/tls"
+	"flag"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
@@ -36,9 +38,23 @@ var tr = &http.Transport{
 	TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
 }
 
+// baseTransport sends every request the suite makes. Cassette replay swaps it
+// for the recorded responses, so it must be the only way out to the network.
+var baseTransport http.RoundTripper = tr
+
+// suiteTransport is the transport of every client in the suite: it sends
+// through whatever baseTransport is, and shows each exchange to the observers
+var suiteTransport = &observedTransport{base: baseRoundTripper{}}
+
+type baseRoundTripper struct{}
+
+func (baseRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return baseTransport.RoundTrip(req)
+}
+
 var cookieJar, _ = cookiejar.New(nil)
 var client = &http.Client{
-	Transport: tr,
+	Transport: suiteTransport,
 	Timeout:   time.Second * 10,
 	Jar:       cookieJar,
 }
@@ -50,9 +66,28 @@ func TestMain(m *testing.M) {
 	// Show source code line numbers relating to log messages
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
-	setupTestDB()
+	flag.Parse()
+
+	setupCassettes()
+
+	// Replayed runs don't have a database to set up
+	if *cassetteMode != "replay" {
+		setupTestDB()
+
+		updateTestDBSchema()
+	}
 
-	updateTestDBSchema()
+	startCassette("TestMain")
+
+	fixtureMaxRecordID = readFixtureMaxRecordID()
+
+	if *employeeCount > 0 {
+		generateOrgchart(*employeeCount, *recordSeed)
+	}
+
+	if *recordCount > 0 {
+		generateRecords(*recordCount, *recordSeed)
+	}
 
 	req, _ := http.NewRequest("GET", RootURL, nil)
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/118.0.0.0 Safari/537.36 Edg/118.0.2088.46")
@@ -67,13 +102,80 @@ func TestMain(m *testing.M) {
 	}
 	body := string(bodyBytes)
 
-	startIdx := strings.Index(body, "var CSRFToken = '") + 17
-	endIdx := strings.Index(body[startIdx:], "';")
-	CsrfToken = body[startIdx : startIdx+endIdx]
+	CsrfToken = readCSRFToken(body)
 
+	if openapiEnabled() {
+		observeTraffic(recordOperation)
+	}
+	if coverageEnabled() {
+		observeTraffic(recordCoverage)
+	}
+	if *diffCollect {
+		observeTraffic(collectDiffRequest)
+	}
+
+	finishCassette()
+
+	trackTests(m)
 	code := m.Run()
 
-	teardownTestDB()
+	if *openapiPath != "" {
+		if err := writeOpenAPI(*openapiPath); err != nil {
+			log.Println("Could not write OpenAPI document: ", err)
+		}
+	}
+	if *openapiUpdate {
+		if err := writeOpenAPI(openapiSpecFile); err != nil {
+			log.Println("Could not write OpenAPI document: ", err)
+		}
+	} else if openapiCompare() {
+		changes, err := diffOpenAPI()
+		if err != nil {
+			log.Println("Could not compare the OpenAPI document: ", err)
+			code = 1
+		} else if len(changes) > 0 {
+			fmt.Printf("\nThe API differs from %s. If this is intended, run with -openapi.update:\n    %s\n", openapiSpecFile, strings.Join(changes, "\n    "))
+			code = 1
+		}
+	}
+
+	if *strictContracts {
+		fmt.Print("\n" + drift.report())
+	}
+
+	if coverageEnabled() {
+		report, err := coverageReport()
+		if err != nil {
+			log.Println("Could not build endpoint coverage report: ", err)
+		} else {
+			fmt.Print(report)
+			if *coverageOut != "" {
+				if err := os.WriteFile(*coverageOut, []byte(report), 0664); err != nil {
+					log.Println("Could not write endpoint coverage report: ", err)
+				}
+			}
+		}
+	}
+
+	if *diffCollect {
+		if err := writeDiffCollected(); err != nil {
+			log.Println("Could not write collected form queries: ", err)
+		}
+	}
+
+	if *sqlProfile {
+		if err := writeSQLProfiles(); err != nil {
+			log.Println("Could not write SQL profiles: ", err)
+		}
+	}
+
+	if *cassetteMode != "" {
+		fmt.Print("\n" + cassetteReport())
+	}
+
+	if *cassetteMode != "replay" {
+		teardownTestDB()
+	}
 
 	os.Exit(code)
 }
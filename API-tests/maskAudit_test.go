@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// The masking auditor replaces every value of an is_sensitive indicator, and
+// every value in a record of a need to know form, with a sentinel naming its
+// record. It then reads those records through each data-bearing endpoint as
+// each non-privileged persona. A sentinel may only appear in a response to a
+// persona who initiated the record or can act on it.
+
+var maskSentinel = regexp.MustCompile(`leafmask(\d+)x(\d+)x(\d+)`)
+
+func maskSentinelValue(recordID int, indicatorID int, series int) string {
+	return fmt.Sprintf("leafmask%dx%dx%d", recordID, indicatorID, series)
+}
+
+// maskPersonaUsers are the users behind the non-privileged personas. nonAdmin
+// is the admin session with masquerade=nonAdmin.
+var maskPersonaUsers = map[string]string{
+	"nonAdmin":           "tester",
+	"requestor":          authzUsers["requestor"],
+	"designatedApprover": authzUsers["designatedApprover"],
+	"groupMember":        authzUsers["groupMember"],
+	"anonymous":          "",
+}
+
+type maskedData struct {
+	recordID    int
+	indicatorID int
+	series      int
+	original    string
+}
+
+// plantMaskSentinels writes the sentinels and restores the original values when the test ends
+func plantMaskSentinels(t *testing.T) []maskedData {
+	t.Helper()
+
+	db := getDB()
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT d.recordID, d.indicatorID, d.series, d.data FROM ` + testPortalDbName + `.data d
+			JOIN ` + testPortalDbName + `.indicators i USING (indicatorID)
+			WHERE i.is_sensitive = 1 AND d.data != ''
+		UNION
+		SELECT d.recordID, d.indicatorID, d.series, d.data FROM ` + testPortalDbName + `.data d
+			JOIN ` + testPortalDbName + `.category_count c ON c.recordID = d.recordID
+			JOIN ` + testPortalDbName + `.categories cat ON cat.categoryID = c.categoryID
+			WHERE cat.needToKnow = 1 AND c.count > 0 AND d.data != ''`)
+	if err != nil {
+		t.Fatalf("Could not find sensitive data: %v", err)
+	}
+	var planted []maskedData
+	for rows.Next() {
+		var m maskedData
+		rows.Scan(&m.recordID, &m.indicatorID, &m.series, &m.original)
+		planted = append(planted, m)
+	}
+	rows.Close()
+
+	t.Cleanup(func() {
+		db := getDB()
+		defer db.Close()
+		for _, m := range planted {
+			if _, err := db.Exec("UPDATE "+testPortalDbName+".data SET data = ? WHERE recordID = ? AND indicatorID = ? AND series = ?",
+				m.original, m.recordID, m.indicatorID, m.series); err != nil {
+				t.Errorf("Could not restore data of record %v, indicator %v: %v", m.recordID, m.indicatorID, err)
+			}
+		}
+	})
+
+	for _, m := range planted {
+		if _, err := db.Exec("UPDATE "+testPortalDbName+".data SET data = ? WHERE recordID = ? AND indicatorID = ? AND series = ?",
+			maskSentinelValue(m.recordID, m.indicatorID, m.series), m.recordID, m.indicatorID, m.series); err != nil {
+			t.Fatalf("Could not write sentinel: %v", err)
+		}
+	}
+	return planted
+}
+
+// maskInitiators returns the initiator of each record
+func maskInitiators(t *testing.T, recordIDs []int) map[int]string {
+	t.Helper()
+
+	db := getDB()
+	defer db.Close()
+
+	initiators := map[int]string{}
+	for _, id := range recordIDs {
+		var userID string
+		if err := db.QueryRow("SELECT userID FROM "+testPortalDbName+".records WHERE recordID = ?", id).Scan(&userID); err != nil {
+			t.Fatalf("Could not read initiator of record %v: %v", id, err)
+		}
+		initiators[id] = userID
+	}
+	return initiators
+}
+
+// maskActionable returns the records a persona can act on
+func maskActionable(p authzPersona) map[int]bool {
+	q := FormQuery{Terms: []FormQueryTerm{{ID: "stepID", Operator: "=", Match: "actionable", Gate: "AND"}}, Joins: []string{}}
+	_, body, err := p.do(authzRow{Method: "GET", Endpoint: "api/form/query?q=" + url.QueryEscape(string(marshalQuery(q)))})
+	ids := map[int]bool{}
+	var v any
+	if err == nil && json.Unmarshal([]byte(body), &v) == nil {
+		responseRecordIDs(v, ids, true)
+	}
+	return ids
+}
+
+// openMaskQuery shortens a query for the record as the admin, the way a report link is shared
+func openMaskQuery(t *testing.T, recordID int, indicatorIDs []string) string {
+	t.Helper()
+
+	q := FormQuery{
+		Terms:   []FormQueryTerm{{ID: "recordID", Operator: "=", Match: strconv.Itoa(recordID), Gate: "AND"}},
+		Joins:   []string{},
+		GetData: indicatorIDs,
+	}
+	res, err := client.PostForm(RootURL+"api/open/form/query", url.Values{"CSRFToken": {CsrfToken}, "data": {string(marshalQuery(q))}})
+	if err != nil {
+		t.Fatalf("Could not shorten a query: %v", err)
+	}
+	defer res.Body.Close()
+	b, _ := io.ReadAll(res.Body)
+
+	var shortCode string
+	if err := json.Unmarshal(b, &shortCode); err != nil || shortCode == "" {
+		t.Fatalf("Could not shorten a query: %v", truncateString(string(b), 200))
+	}
+	return shortCode
+}
+
+// maskEndpoints are the data-bearing reads of a record
+func maskEndpoints(t *testing.T, recordID int, indicatorIDs []string) []string {
+	t.Helper()
+
+	id := strconv.Itoa(recordID)
+	q := FormQuery{
+		Terms:   []FormQueryTerm{{ID: "recordID", Operator: "=", Match: id, Gate: "AND"}},
+		Joins:   []string{},
+		GetData: indicatorIDs,
+	}
+	return []string{
+		"api/form/" + id + "/data",
+		"api/form/" + id + "/data/tree",
+		"api/form/query?q=" + url.QueryEscape(string(marshalQuery(q))),
+		"api/open/form/query/_" + openMaskQuery(t, recordID, indicatorIDs),
+		"ajaxIndex.php?a=printview&recordID=" + id,
+		"index.php?a=printview&recordID=" + id,
+	}
+}
+
+// TestMasking_SensitiveData audits every endpoint in maskEndpoints for every
+// record holding sensitive data, as every non-privileged persona
+func TestMasking_SensitiveData(t *testing.T) {
+	planted := plantMaskSentinels(t)
+	if len(planted) == 0 {
+		t.Skip("the test database has no sensitive data")
+	}
+
+	indicatorsByRecord := map[int][]string{}
+	for _, m := range planted {
+		indicatorsByRecord[m.recordID] = append(indicatorsByRecord[m.recordID], strconv.Itoa(m.indicatorID))
+	}
+	var recordIDs []int
+	for id := range indicatorsByRecord {
+		recordIDs = append(recordIDs, id)
+	}
+	sort.Ints(recordIDs)
+	initiators := maskInitiators(t, recordIDs)
+	endpoints := map[int][]string{}
+	for _, id := range recordIDs {
+		endpoints[id] = maskEndpoints(t, id, indicatorsByRecord[id])
+	}
+
+	personas := newAuthzPersonas()
+	names := make([]string, 0, len(maskPersonaUsers))
+	for name := range maskPersonaUsers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	leaks := map[string]int{}
+	for _, name := range names {
+		p := personas[name]
+		if p.unavailable != "" {
+			t.Logf("Persona %s is skipped: %s", name, p.unavailable)
+			continue
+		}
+		actionable := maskActionable(p)
+		entitled := func(recordID int) bool {
+			user := maskPersonaUsers[name]
+			return actionable[recordID] || user != "" && strings.EqualFold(initiators[recordID], user)
+		}
+
+		for _, recordID := range recordIDs {
+			for _, endpoint := range endpoints[recordID] {
+				_, body, err := p.do(authzRow{Method: "GET", Endpoint: endpoint})
+				if err != nil {
+					t.Errorf("%s as %s: %v", endpoint, name, err)
+					continue
+				}
+
+				reported := map[string]bool{}
+				for _, m := range maskSentinel.FindAllStringSubmatch(body, -1) {
+					leaked, _ := strconv.Atoi(m[1])
+					if entitled(leaked) || reported[m[0]] {
+						continue
+					}
+					reported[m[0]] = true
+					leaks[name]++
+					t.Errorf("SECURITY FAILURE: %s as %s shows indicator %v of record %v unmasked", truncateString(endpoint, 80), name, m[2], leaked)
+				}
+			}
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d sensitive value(s) in %d record(s)\n", len(planted), len(recordIDs))
+	for _, name := range names {
+		fmt.Fprintf(&sb, "%-20s %d unmasked\n", name, leaks[name])
+	}
+	t.Log("\n" + sb.String())
+}
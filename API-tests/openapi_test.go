@@ -0,0 +1,377 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// The suite's traffic doubles as documentation of the LEAF APIs. Every request
+// is recorded and, after a run of the whole suite, described as an OpenAPI 3
+// document and compared with testdata/openapi.json once it is committed, so
+// API changes show up as a failed run. Response schemas come from the Go response
+// types where a test decodes the response with decodeJSON, and are inferred
+// from the JSON otherwise. To create the file, or after an intended change,
+// rewrite it with:
+//
+//	go test -openapi.update
+var openapiPath = flag.String("openapi", "", "write an OpenAPI 3 description of the requests made by the suite to this file")
+var openapiUpdate = flag.Bool("openapi.update", false, "rewrite "+openapiSpecFile+" with the requests made by the suite")
+
+const openapiSpecFile = "testdata/openapi.json"
+
+// openapiEnabled reports whether the run records traffic for the OpenAPI document
+func openapiEnabled() bool {
+	return *openapiPath != "" || *openapiUpdate || openapiCompare()
+}
+
+// openapiCompare reports whether the run is compared with the committed
+// document. Comparing needs the whole suite, since a -run subset makes fewer
+// requests, and is skipped until testdata/openapi.json exists.
+func openapiCompare() bool {
+	if _, err := os.Stat(openapiSpecFile); err != nil {
+		return false
+	}
+	run := flag.Lookup("test.run")
+	return run == nil || run.Value.String() == ""
+}
+
+// apiOperation aggregates the calls observed for one method and route
+type apiOperation struct {
+	calls       int
+	queryParams map[string]int // name -> number of calls that included it
+	formFields  map[string]int
+	statuses    map[int]any // status -> JSON body of the first response with that status
+}
+
+type apiTraffic struct {
+	mu            sync.Mutex
+	operations    map[string]map[string]*apiOperation // route -> method -> operation
+	responseTypes map[string]reflect.Type
+}
+
+var traffic = apiTraffic{
+	operations:    map[string]map[string]*apiOperation{},
+	responseTypes: map[string]reflect.Type{},
+}
+
+// recordResponseType notes the Go type a test decodes an endpoint's responses into
+func recordResponseType(url string, t reflect.Type) {
+	if !openapiEnabled() {
+		return
+	}
+
+	traffic.mu.Lock()
+	defer traffic.mu.Unlock()
+	traffic.responseTypes[routeTemplate(url)] = t
+}
+
+// recordOperation is a trafficObserver
+func recordOperation(ex *exchange) {
+	if ex.Response == nil || !strings.HasPrefix(ex.Request.URL.String(), HostURL) {
+		return
+	}
+
+	route := routeTemplate(ex.Request.URL.String())
+	method := strings.ToLower(ex.Request.Method)
+
+	traffic.mu.Lock()
+	defer traffic.mu.Unlock()
+
+	if traffic.operations[route] == nil {
+		traffic.operations[route] = map[string]*apiOperation{}
+	}
+	op := traffic.operations[route][method]
+	if op == nil {
+		op = &apiOperation{queryParams: map[string]int{}, formFields: map[string]int{}, statuses: map[int]any{}}
+		traffic.operations[route][method] = op
+	}
+
+	op.calls++
+	for name := range ex.Request.URL.Query() {
+		op.queryParams[name]++
+	}
+	if strings.HasPrefix(ex.Request.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		if form, err := url.ParseQuery(string(ex.RequestBody)); err == nil {
+			for name := range form {
+				op.formFields[name]++
+			}
+		}
+	}
+
+	if _, ok := op.statuses[ex.Response.StatusCode]; !ok {
+		var body any
+		if json.Unmarshal(ex.ResponseBody, &body) != nil {
+			body = nil
+		}
+		op.statuses[ex.Response.StatusCode] = body
+	}
+}
+
+// openapiDocument builds an OpenAPI 3 document from the recorded traffic
+func (a *apiTraffic) openapiDocument() map[string]any {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	schemas := map[string]any{}
+	paths := map[string]any{}
+	for route, methods := range a.operations {
+		item := map[string]any{}
+		for method, op := range methods {
+			operation := map[string]any{
+				"summary":    fmt.Sprintf("%s %s", strings.ToUpper(method), route),
+				"parameters": openapiParameters(route, op),
+			}
+
+			if len(op.formFields) > 0 {
+				operation["requestBody"] = map[string]any{
+					"content": map[string]any{
+						"application/x-www-form-urlencoded": map[string]any{
+							"schema": openapiFields(op.formFields, op.calls),
+						},
+					},
+				}
+			}
+
+			responses := map[string]any{}
+			for status, body := range op.statuses {
+				response := map[string]any{"description": http.StatusText(status)}
+
+				var schema any
+				if t, ok := a.responseTypes[route]; ok && method == "get" && status == http.StatusOK {
+					schema = schemaFromType(t, schemas)
+				} else if body != nil {
+					schema = schemaFromJSON(body)
+				}
+				if schema != nil {
+					response["content"] = map[string]any{"application/json": map[string]any{"schema": schema}}
+				}
+				responses[fmt.Sprint(status)] = response
+			}
+			operation["responses"] = responses
+
+			item[method] = operation
+		}
+		paths[route] = item
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "LEAF API (as exercised by LEAF/API-tester)",
+			"description": "Generated from the requests made by the API test suite. Regenerate with: go test -openapi.update",
+			"version":     "generated",
+		},
+		"servers":    []any{map[string]any{"url": HostURL}},
+		"paths":      paths,
+		"components": map[string]any{"schemas": schemas},
+	}
+}
+
+// openapiParameters lists path parameters from the route template and the query parameters seen
+func openapiParameters(route string, op *apiOperation) []any {
+	params := []any{}
+	for _, segment := range strings.Split(route, "/") {
+		switch segment {
+		case "{id}":
+			params = append(params, map[string]any{"name": "id", "in": "path", "required": true, "schema": map[string]any{"type": "integer"}})
+		case "{categoryID}":
+			params = append(params, map[string]any{"name": "categoryID", "in": "path", "required": true, "schema": map[string]any{"type": "string"}})
+		}
+	}
+
+	names := make([]string, 0, len(op.queryParams))
+	for name := range op.queryParams {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		params = append(params, map[string]any{
+			"name":     name,
+			"in":       "query",
+			"required": op.queryParams[name] == op.calls,
+			"schema":   map[string]any{"type": "string"},
+		})
+	}
+
+	return params
+}
+
+// openapiFields describes form fields; fields sent on every call are marked required
+func openapiFields(fields map[string]int, calls int) map[string]any {
+	properties := map[string]any{}
+	required := []string{}
+	for name, n := range fields {
+		properties[name] = map[string]any{"type": "string"}
+		if n == calls {
+			required = append(required, name)
+		}
+	}
+	sort.Strings(required)
+
+	schema := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// schemaFromType describes a Go response type. Named structs go into schemas and are referenced.
+func schemaFromType(t reflect.Type, schemas map[string]any) map[string]any {
+	switch t.Kind() {
+	case reflect.Pointer:
+		s := schemaFromType(t.Elem(), schemas)
+		if _, isRef := s["$ref"]; isRef {
+			return map[string]any{"allOf": []any{s}, "nullable": true}
+		}
+		s["nullable"] = true
+		return s
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": schemaFromType(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaFromType(t.Elem(), schemas)}
+	case reflect.Struct:
+		if t.Name() != "" {
+			if _, ok := schemas[t.Name()]; !ok {
+				schemas[t.Name()] = map[string]any{} // placeholder for recursive types
+				schemas[t.Name()] = structSchema(t, schemas)
+			}
+			return map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+		}
+		return structSchema(t, schemas)
+	}
+
+	// interface{} and anything else accepts any value
+	return map[string]any{}
+}
+
+func structSchema(t reflect.Type, schemas map[string]any) map[string]any {
+	properties := map[string]any{}
+	for _, f := range jsonFields(t) {
+		properties[f.name] = schemaFromType(f.typ, schemas)
+	}
+	return map[string]any{"type": "object", "properties": properties}
+}
+
+// schemaFromJSON infers a schema from a decoded response body
+func schemaFromJSON(v any) map[string]any {
+	switch val := v.(type) {
+	case map[string]any:
+		properties := map[string]any{}
+		for k, child := range val {
+			properties[k] = schemaFromJSON(child)
+		}
+		return map[string]any{"type": "object", "properties": properties}
+	case []any:
+		if len(val) == 0 {
+			return map[string]any{"type": "array", "items": map[string]any{}}
+		}
+		return map[string]any{"type": "array", "items": schemaFromJSON(val[0])}
+	case string:
+		return map[string]any{"type": "string"}
+	case float64:
+		if val == float64(int64(val)) {
+			return map[string]any{"type": "integer"}
+		}
+		return map[string]any{"type": "number"}
+	case bool:
+		return map[string]any{"type": "boolean"}
+	}
+	return map[string]any{"nullable": true}
+}
+
+// marshalOpenAPI encodes the document with sorted keys, so regenerating it only shows real changes
+func marshalOpenAPI(doc map[string]any) ([]byte, error) {
+	b, err := json.MarshalIndent(doc, "", "  ")
+	return append(b, '\n'), err
+}
+
+func writeOpenAPI(path string) error {
+	b, err := marshalOpenAPI(traffic.openapiDocument())
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0664)
+}
+
+// diffOpenAPI compares the recorded traffic with the committed document and
+// lists the operations and schemas that were added, removed or changed. The
+// servers are left out, since they depend on APP_HTTP_HOST.
+func diffOpenAPI() ([]string, error) {
+	b, err := os.ReadFile(openapiSpecFile)
+	if err != nil {
+		return nil, fmt.Errorf("%w. Run with -openapi.update to create it, then commit it", err)
+	}
+	var want map[string]any
+	if err := json.Unmarshal(b, &want); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %w", openapiSpecFile, err)
+	}
+
+	// Round trip the generated document, so both sides hold the same JSON types
+	b, err = marshalOpenAPI(traffic.openapiDocument())
+	if err != nil {
+		return nil, err
+	}
+	var got map[string]any
+	json.Unmarshal(b, &got)
+
+	var changes []string
+	for _, section := range []string{"paths", "components"} {
+		changes = append(changes, diffOpenAPISection(section, want[section], got[section], 2)...)
+	}
+	return changes, nil
+}
+
+// diffOpenAPISection lists the keys of a section that were added, removed or
+// changed, descending depth levels to name e.g. the method of a route
+func diffOpenAPISection(section string, want any, got any, depth int) []string {
+	wantMap, _ := want.(map[string]any)
+	gotMap, _ := got.(map[string]any)
+
+	keys := map[string]bool{}
+	for k := range wantMap {
+		keys[k] = true
+	}
+	for k := range gotMap {
+		keys[k] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	var changes []string
+	for _, k := range sorted {
+		w, inWant := wantMap[k]
+		g, inGot := gotMap[k]
+		switch {
+		case !inWant:
+			changes = append(changes, "added: "+section+" "+k)
+		case !inGot:
+			changes = append(changes, "removed: "+section+" "+k)
+		case reflect.DeepEqual(w, g):
+		case depth > 1:
+			changes = append(changes, diffOpenAPISection(section+" "+k, w, g, depth-1)...)
+		default:
+			changes = append(changes, "changed: "+section+" "+k)
+		}
+	}
+	return changes
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/json"
 	"io"
 	"log"
 	"testing"
@@ -13,7 +12,7 @@ func getOrgchartImportTags(url string) PlatformResponse {
 	b, _ := io.ReadAll(res.Body)
 
 	var m PlatformResponse
-	err := json.Unmarshal(b, &m)
+	err := decodeJSON(url, b, &m)
 
 	if err != nil {
 		log.Printf("JSON parsing error, couldn't parse: %v", string(b))
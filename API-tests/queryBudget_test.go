@@ -0,0 +1,111 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"os"
+	"sync"
+	"testing"
+)
+
+// Query budgets catch endpoints that start issuing more SQL statements than
+// they used to. Budgets live in testdata/query_budgets.json; after an intended
+// change, record the new counts with:
+//
+//	go test -run="QueryBudget|PendingGroupDesignatedNames" -querybudget.update
+var queryBudgetUpdate = flag.Bool("querybudget.update", false, "record measured statement counts as the new query budgets")
+
+const queryBudgetFile = "testdata/query_budgets.json"
+
+var queryBudgets map[string]int
+var queryBudgetsLoaded bool
+var mxQueryBudgets sync.Mutex
+
+// loadQueryBudgets reads the budgets file once
+func loadQueryBudgets() map[string]int {
+	if !queryBudgetsLoaded {
+		queryBudgets = map[string]int{}
+		if b, err := os.ReadFile(queryBudgetFile); err == nil {
+			json.Unmarshal(b, &queryBudgets)
+		}
+		queryBudgetsLoaded = true
+	}
+	return queryBudgets
+}
+
+// countStatements returns the number of SQL statements run so far by the test
+// database user. LEAF connects as the same user in the dev environment, so this
+// includes the statements behind API requests.
+func countStatements(db *sql.DB) (int, error) {
+	var count int
+	err := db.QueryRow(`SELECT COALESCE(SUM(COUNT_STAR), 0)
+						FROM performance_schema.events_statements_summary_by_user_by_event_name
+						WHERE USER = ? AND EVENT_NAME LIKE 'statement/sql/%'`, dbUsername).Scan(&count)
+	return count, err
+}
+
+// assertQueryBudget runs fn and fails the test if it caused more SQL statements
+// than the budget recorded under name. fn runs once, so tests that measure
+// their own requests don't add traffic.
+func assertQueryBudget(t *testing.T, name string, fn func()) {
+	t.Helper()
+
+	db := getDB()
+	defer db.Close()
+
+	// The counter query itself counts as a statement, so measure that overhead first
+	c0, err := countStatements(db)
+	if err != nil {
+		t.Logf("Query budget %s not checked (the MySQL user needs access to performance_schema): %v", name, err)
+		fn()
+		return
+	}
+	c1, _ := countStatements(db)
+	overhead := c1 - c0
+
+	fn()
+
+	c2, _ := countStatements(db)
+	used := c2 - c1 - overhead
+
+	mxQueryBudgets.Lock()
+	defer mxQueryBudgets.Unlock()
+	budgets := loadQueryBudgets()
+
+	if *queryBudgetUpdate {
+		budgets[name] = used
+		b, _ := json.MarshalIndent(budgets, "", "    ")
+		if err := os.WriteFile(queryBudgetFile, append(b, '\n'), 0664); err != nil {
+			t.Errorf("Could not write %s: %v", queryBudgetFile, err)
+		}
+		t.Logf("Query budget %s = %d statements", name, used)
+		return
+	}
+
+	budget, ok := budgets[name]
+	if !ok {
+		t.Errorf("No query budget for %s in %s (used %d statements). Run with -querybudget.update to record it, then commit it.", name, queryBudgetFile, used)
+		return
+	}
+	if used > budget {
+		t.Errorf("%s SQL statements = %v, want <= %v. If this is intended, update the budget with -querybudget.update", name, used, budget)
+	}
+}
+
+func TestQueryBudget_HotspotQueries(t *testing.T) {
+	hotspots := map[string]string{
+		"homepage":                      loadHomepageQuery,
+		"inbox_adminActionableRoles":    loadInboxQuery,
+		"inbox_nonAdminActionableRoles": loadInboxQuery + `&masquerade=nonAdmin`,
+		"formWorkflow_currentStep":      `api/formWorkflow/484/currentStep`,
+	}
+
+	for name, path := range hotspots {
+		t.Run(name, func(t *testing.T) {
+			assertQueryBudget(t, name, func() {
+				httpGet(RootURL + path)
+			})
+		})
+	}
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The query fuzzer generates form queries from the FormQuery model, both
+// well-formed and malformed, and sends each as an admin and as a masqueraded
+// non-admin, who may only see need to know records it initiated or can act on.
+// Each finding is shrunk to a minimal query that still reproduces it.
+//
+//	go test -run=TestFormQuery_GrammarFuzz -queryfuzz.n=500 -seed=7
+var queryFuzzCount = flag.Int("queryfuzz.n", 0, "number of generated form queries sent by TestFormQuery_GrammarFuzz, 0 to skip it")
+var queryFuzzSlow = flag.Duration("queryfuzz.slow", 3*time.Second, "report form queries slower than this")
+
+// queryFuzzMaxShrink caps the requests spent minimizing one finding
+const queryFuzzMaxShrink = 200
+
+var queryFuzzTermIDs = []string{"recordID", "recordIDs", "title", "userID", "serviceID", "service", "priority", "date",
+	"dateInitiated", "dateSubmitted", "submitted", "deleted", "categoryID", "stepID", "stepAction", "dependencyID", "data"}
+var queryFuzzOperators = []string{"=", "!=", "<", "<=", ">", ">=", "LIKE", "NOT LIKE", "RLIKE", "IN", "", "=="}
+var queryFuzzGates = []string{"AND", "OR", "and", "XOR", ""}
+var queryFuzzJoins = []string{"service", "status", "categoryName", "categoryNameUnabridged", "categoryID", "initiatorName",
+	"action_history", "unfilledDependencies", "recordsDependencies", "recordResolutionData", "recordResolutionBy", "notAJoin"}
+var queryFuzzSortColumns = []string{"recordID", "date", "title", "service", "priority", "userID", "notAColumn", "recordID; --"}
+var queryFuzzMatches = []any{0, 1, -1, 505, 1e20, 3.5, "", "*", "***", "Request*", "*e*", "ñ☃", "'", `"`, `\`, "%", "_",
+	"resolved", "actionable", "submitted", "notSubmitted", "deleted", "2020-01-01", "form_5ea07", "tester",
+	nil, true, []any{1, 2}, map[string]any{"a": 1}}
+var queryFuzzIndicatorIDs = []string{"3", "8", "-1", "0", "999999", "abc"}
+
+// queryFuzzPHPError and queryFuzzSQLError find PHP diagnostics and database errors echoed in a response
+var queryFuzzPHPError = regexp.MustCompile(`(?i)(<b>)?(warning|notice|deprecated|fatal error|parse error)(</b>)?: .{0,200}? on line \d+|Stack trace:|Uncaught \w+`)
+var queryFuzzSQLError = regexp.MustCompile(`(?i)SQLSTATE\[|error in your SQL syntax|PDOException|Unknown column '|Incorrect \w+ value`)
+
+// queryMalformation breaks a well-formed query in one way, so shrinking the
+// query keeps the same kind of damage
+type queryMalformation struct {
+	kind string // "", "truncate", "drop", "wrongType" or "unknownKey"
+	key  string
+	cut  int
+}
+
+type queryCase struct {
+	query   FormQuery
+	malform queryMalformation
+}
+
+func (c queryCase) q() string {
+	b := marshalQuery(c.query)
+
+	switch c.malform.kind {
+	case "truncate":
+		return string(b[:c.malform.cut%len(b)])
+	case "drop", "wrongType", "unknownKey":
+		var doc map[string]any
+		json.Unmarshal(b, &doc)
+		switch c.malform.kind {
+		case "drop":
+			delete(doc, c.malform.key)
+		case "wrongType":
+			if _, isString := doc[c.malform.key].(string); isString {
+				doc[c.malform.key] = []any{1}
+			} else {
+				doc[c.malform.key] = "1"
+			}
+		case "unknownKey":
+			doc[c.malform.key] = 1
+		}
+		b = marshalQuery(doc)
+	}
+	return string(b)
+}
+
+// marshalQuery encodes without escaping <, > and &, so reproducers read like the queries LEAF's pages send
+func marshalQuery(v any) []byte {
+	var sb strings.Builder
+	e := json.NewEncoder(&sb)
+	e.SetEscapeHTML(false)
+	e.Encode(v)
+	return []byte(strings.TrimSuffix(sb.String(), "\n"))
+}
+
+func genQueryCase(rnd *rand.Rand) queryCase {
+	pick := func(s []string) string { return s[rnd.Intn(len(s))] }
+
+	c := queryCase{query: FormQuery{Terms: []FormQueryTerm{}, Joins: []string{}}}
+	for i := rnd.Intn(5); i > 0; i-- {
+		term := FormQueryTerm{
+			ID:       pick(queryFuzzTermIDs),
+			Operator: pick(queryFuzzOperators),
+			Match:    queryFuzzMatches[rnd.Intn(len(queryFuzzMatches))],
+			Gate:     pick(queryFuzzGates),
+		}
+		if term.ID == "data" || rnd.Intn(10) == 0 {
+			term.IndicatorID = pick(queryFuzzIndicatorIDs)
+		}
+		if rnd.Intn(20) == 0 {
+			term.ID = fmt.Sprintf("notATerm%d", rnd.Intn(100))
+		}
+		c.query.Terms = append(c.query.Terms, term)
+	}
+	for _, join := range queryFuzzJoins {
+		if rnd.Intn(4) == 0 {
+			c.query.Joins = append(c.query.Joins, join)
+		}
+	}
+	if rnd.Intn(2) == 0 {
+		c.query.Sort = FormQuerySort{Column: pick(queryFuzzSortColumns), Direction: pick([]string{"ASC", "DESC", "asc", "sideways"})}
+	}
+	if rnd.Intn(2) == 0 {
+		c.query.Limit = []any{0, 1, 50, -1, 100000, "10", "1; --"}[rnd.Intn(7)]
+	}
+	if rnd.Intn(3) == 0 {
+		c.query.LimitOffset = []any{0, 25, -5, 1e9, "x"}[rnd.Intn(5)]
+	}
+	if rnd.Intn(3) == 0 {
+		for i := rnd.Intn(4); i >= 0; i-- {
+			c.query.GetData = append(c.query.GetData, pick(queryFuzzIndicatorIDs))
+		}
+	}
+
+	// About four in ten queries are malformed
+	keys := []string{"terms", "joins", "sort", "limit", "getData"}
+	switch rnd.Intn(10) {
+	case 0:
+		c.malform = queryMalformation{kind: "truncate", cut: rnd.Intn(1000) + 1}
+	case 1:
+		c.malform = queryMalformation{kind: "drop", key: pick(keys)}
+	case 2:
+		c.malform = queryMalformation{kind: "wrongType", key: pick(keys)}
+	case 3:
+		c.malform = queryMalformation{kind: "unknownKey", key: "fuzz"}
+	}
+	return c
+}
+
+// queryFinding is a problem with one response
+type queryFinding struct {
+	kind       string
+	detail     string
+	masquerade bool
+}
+
+type queryResponse struct {
+	status   int
+	body     string
+	duration time.Duration
+}
+
+func sendFuzzQuery(q string, masquerade bool) (queryResponse, error) {
+	target := RootURL + "api/form/query?q=" + url.QueryEscape(q)
+	if masquerade {
+		target += "&masquerade=nonAdmin"
+	}
+
+	start := time.Now()
+	res, err := client.Get(target)
+	if err != nil {
+		return queryResponse{}, err
+	}
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	return queryResponse{status: res.StatusCode, body: string(b), duration: time.Since(start)}, err
+}
+
+func (r queryResponse) findings(masquerade bool) []queryFinding {
+	var found []queryFinding
+	if r.status >= 500 {
+		found = append(found, queryFinding{"HTTP 500", fmt.Sprintf("status %d", r.status), masquerade})
+	}
+	if m := queryFuzzPHPError.FindString(r.body); m != "" {
+		found = append(found, queryFinding{"PHP warning", m, masquerade})
+	}
+	if m := queryFuzzSQLError.FindString(r.body); m != "" {
+		found = append(found, queryFinding{"SQL error", m, masquerade})
+	}
+	if r.duration > *queryFuzzSlow {
+		found = append(found, queryFinding{"slow response", r.duration.Round(time.Millisecond).String(), masquerade})
+	}
+	return found
+}
+
+// queryFuzzHidden returns the need to know records the masqueraded non-admin
+// isn't entitled to, which are those it neither initiated nor can act on
+func queryFuzzHidden(t *testing.T) map[int]bool {
+	t.Helper()
+
+	db := getDB()
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT DISTINCT c.recordID FROM ` + testPortalDbName + `.category_count c
+		JOIN ` + testPortalDbName + `.categories cat ON cat.categoryID = c.categoryID
+		WHERE cat.needToKnow = 1 AND c.count > 0`)
+	if err != nil {
+		t.Fatalf("Could not find need to know records: %v", err)
+	}
+	var recordIDs []int
+	for rows.Next() {
+		var id int
+		rows.Scan(&id)
+		recordIDs = append(recordIDs, id)
+	}
+	rows.Close()
+
+	initiators := maskInitiators(t, recordIDs)
+	actionable := maskActionable(newAuthzPersonas()["nonAdmin"])
+	hidden := map[int]bool{}
+	for _, id := range recordIDs {
+		if !actionable[id] && !strings.EqualFold(initiators[id], maskPersonaUsers["nonAdmin"]) {
+			hidden[id] = true
+		}
+	}
+	return hidden
+}
+
+// runQueryCase sends c as both personas. The non-admin must never see a record in hidden.
+func runQueryCase(c queryCase, hidden map[int]bool) ([]queryFinding, error) {
+	q := c.q()
+	admin, err := sendFuzzQuery(q, false)
+	if err != nil {
+		return nil, err
+	}
+	nonAdmin, err := sendFuzzQuery(q, true)
+	if err != nil {
+		return nil, err
+	}
+
+	found := append(admin.findings(false), nonAdmin.findings(true)...)
+
+	var nonAdminRecords map[string]json.RawMessage
+	if nonAdmin.status == 200 && json.Unmarshal([]byte(nonAdmin.body), &nonAdminRecords) == nil {
+		var leaked []int
+		for key := range nonAdminRecords {
+			if id, err := strconv.Atoi(key); err == nil && hidden[id] {
+				leaked = append(leaked, id)
+			}
+		}
+		if len(leaked) > 0 {
+			sort.Ints(leaked)
+			found = append(found, queryFinding{"masquerade violation", fmt.Sprintf("non-admin sees need to know records %v", leaked), true})
+		}
+	}
+	return found, nil
+}
+
+func hasFindingKind(found []queryFinding, kind string) bool {
+	for _, f := range found {
+		if f.kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// shrinkCandidates lists smaller or simpler versions of c, one change each
+func shrinkCandidates(c queryCase) []queryCase {
+	var out []queryCase
+	with := func(change func(q *FormQuery)) {
+		next := c
+		next.query.Terms = append([]FormQueryTerm{}, c.query.Terms...)
+		next.query.Joins = append([]string{}, c.query.Joins...)
+		next.query.GetData = append([]string(nil), c.query.GetData...)
+		change(&next.query)
+		out = append(out, next)
+	}
+
+	if c.malform.kind != "" {
+		out = append(out, queryCase{query: c.query})
+	}
+	for i := range c.query.Terms {
+		with(func(q *FormQuery) { q.Terms = append(q.Terms[:i], q.Terms[i+1:]...) })
+	}
+	for i := range c.query.Joins {
+		with(func(q *FormQuery) { q.Joins = append(q.Joins[:i], q.Joins[i+1:]...) })
+	}
+	if c.query.GetData != nil {
+		with(func(q *FormQuery) { q.GetData = nil })
+	}
+	if c.query.Sort != (FormQuerySort{}) {
+		with(func(q *FormQuery) { q.Sort = FormQuerySort{} })
+	}
+	if c.query.Limit != nil {
+		with(func(q *FormQuery) { q.Limit = nil })
+	}
+	if c.query.LimitOffset != nil {
+		with(func(q *FormQuery) { q.LimitOffset = nil })
+	}
+	for i, term := range c.query.Terms {
+		if term.Gate != "AND" {
+			with(func(q *FormQuery) { q.Terms[i].Gate = "AND" })
+		}
+		if term.IndicatorID != "" && term.ID != "data" {
+			with(func(q *FormQuery) { q.Terms[i].IndicatorID = "" })
+		}
+	}
+	return out
+}
+
+// shrinkQueryCase greedily applies shrinking steps that keep a finding of the same kind
+func shrinkQueryCase(c queryCase, kind string, hidden map[int]bool) queryCase {
+	requests := 0
+	for shrunk := true; shrunk && requests < queryFuzzMaxShrink; {
+		shrunk = false
+		for _, candidate := range shrinkCandidates(c) {
+			requests++
+			found, err := runQueryCase(candidate, hidden)
+			if err == nil && hasFindingKind(found, kind) {
+				c = candidate
+				shrunk = true
+				break
+			}
+			if requests >= queryFuzzMaxShrink {
+				break
+			}
+		}
+	}
+	return c
+}
+
+// TestFormQuery_GrammarFuzz is skipped unless -queryfuzz.n is set
+func TestFormQuery_GrammarFuzz(t *testing.T) {
+	if *queryFuzzCount <= 0 {
+		t.Skip("set -queryfuzz.n to fuzz api/form/query")
+	}
+
+	hidden := queryFuzzHidden(t)
+	rnd := rand.New(rand.NewSource(*recordSeed))
+	first := map[string]queryCase{}
+	counts := map[string]int{}
+	for i := 0; i < *queryFuzzCount; i++ {
+		c := genQueryCase(rnd)
+		found, err := runQueryCase(c, hidden)
+		if err != nil {
+			t.Errorf("Request failed: %v\nq=%s", err, c.q())
+			continue
+		}
+		seen := map[string]bool{}
+		for _, f := range found {
+			if seen[f.kind] {
+				continue
+			}
+			seen[f.kind] = true
+			counts[f.kind]++
+			if _, exists := first[f.kind]; !exists {
+				first[f.kind] = c
+			}
+		}
+	}
+
+	kinds := make([]string, 0, len(first))
+	for kind := range first {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	for _, kind := range kinds {
+		minimal := shrinkQueryCase(first[kind], kind, hidden)
+		found, _ := runQueryCase(minimal, hidden)
+		var details []string
+		for _, f := range found {
+			if f.kind != kind {
+				continue
+			}
+			persona := "admin"
+			if f.masquerade {
+				persona = "nonAdmin"
+			}
+			details = append(details, persona+": "+truncateString(f.detail, 300))
+		}
+		t.Errorf("%s in %d of %d queries. Minimal reproducer:\n    q=%s\n    %s", kind, counts[kind], *queryFuzzCount, minimal.q(), strings.Join(details, "\n    "))
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// FuzzAuthDomainRedirect mutates the r parameter of auth_domain/ and follows
+// the redirects, failing if any of them leaves the LEAF host. Inputs that fail
+// are saved by the fuzzer to testdata/fuzz/FuzzAuthDomainRedirect, and every
+// saved input runs as a regression test with a plain go test.
+//
+//	go test -run=XXX -fuzz=FuzzAuthDomainRedirect -fuzztime=5m
+func FuzzAuthDomainRedirect(f *testing.F) {
+	// The payloads checked in authenticationSecurity_test.go
+	f.Add("@example.com/test", uint8(0))
+	f.Add("/\nhttps://example.com", uint8(0))
+	f.Add("/?a=reports&email=user@example.com", uint8(0))
+	f.Add("/?a=reports&v=3&status=active", uint8(0))
+
+	f.Fuzz(func(t *testing.T, payload string, transform uint8) {
+		r := redirectParam(payload, transform)
+		hops, err := followRedirects(RootURL + "auth_domain/?r=" + r)
+		if err != nil {
+			t.Errorf("SECURITY FAILURE: %v\nPayload: %q, transform %v\nRedirects: %v", err, payload, transform%redirectTransforms, strings.Join(hops, " -> "))
+		}
+	})
+}
+
+// redirectTransforms is the number of ways redirectParam encodes a payload
+const redirectTransforms = 9
+
+// redirectParam encodes payload as the r parameter. transform picks an encoding
+// or a rewrite that has been used to get past redirect filters.
+func redirectParam(payload string, transform uint8) string {
+	encoding := base64.StdEncoding
+	switch transform % redirectTransforms {
+	case 1:
+		payload = percentEncode(payload)
+	case 2:
+		payload = percentEncode(percentEncode(payload))
+	case 3:
+		payload = strings.ReplaceAll(payload, "/", `\`)
+	case 4:
+		payload = strings.ReplaceAll(payload, ".", "。") // ideographic full stop
+	case 5:
+		payload = "//" + strings.TrimLeft(payload, "/")
+	case 6:
+		payload = "https:" + payload
+	case 7:
+		encoding = base64.URLEncoding
+	case 8:
+		return url.QueryEscape(payload)
+	}
+	return url.QueryEscape(encoding.EncodeToString([]byte(payload)))
+}
+
+// percentEncode escapes every byte other than letters and digits
+func percentEncode(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' {
+			sb.WriteByte(c)
+		} else {
+			fmt.Fprintf(&sb, "%%%02X", c)
+		}
+	}
+	return sb.String()
+}
+
+// followRedirects requests start with noRedirectClient and follows Location
+// headers the way a browser would. It returns an error for the first redirect
+// that leaves the LEAF host or uses a scheme other than http(s).
+func followRedirects(start string) ([]string, error) {
+	leafURL, _ := url.Parse(HostURL)
+	current, err := url.Parse(start)
+	if err != nil {
+		return nil, err
+	}
+
+	var hops []string
+	for i := 0; i < 10; i++ {
+		res, err := noRedirectClient.Get(current.String())
+		if err != nil {
+			// Every request here is to the LEAF host, so a failure isn't an open redirect
+			return hops, nil
+		}
+		res.Body.Close()
+
+		location := res.Header.Get("Location")
+		if res.StatusCode < 300 || res.StatusCode >= 400 || location == "" {
+			return hops, nil
+		}
+		hops = append(hops, location)
+
+		// Browsers drop tabs and newlines from URLs and treat backslashes as slashes
+		location = strings.NewReplacer("\t", "", "\n", "", "\r", "", `\`, "/").Replace(strings.TrimSpace(location))
+		next, err := url.Parse(location)
+		if err != nil {
+			return hops, nil
+		}
+		next = current.ResolveReference(next)
+
+		if next.Scheme != "http" && next.Scheme != "https" {
+			return hops, fmt.Errorf("redirected to scheme %q", next.Scheme)
+		}
+		if !strings.EqualFold(next.Hostname(), leafURL.Hostname()) {
+			return hops, fmt.Errorf("redirected to host %q", next.Hostname())
+		}
+		current = next
+	}
+	return hops, nil
+}
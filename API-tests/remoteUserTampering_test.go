@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// The REMOTE_USER tampering tests send auth_cookie modified cookies and read
+// the user of the resulting session from the sessions table. AES-CTR has no
+// integrity check, so a cookie can be edited without the key; auth_cookie must
+// still never log in as anyone other than the user the cookie was issued to.
+
+// tamperUser is a non-admin fixture user whose cookie is tampered with
+const tamperUser = "VTRGBKJEANNINE"
+
+// tamperTarget is an admin the tampered cookies try to become
+const tamperTarget = "tester"
+
+var sessionUserID = regexp.MustCompile(`userID\|s:\d+:"([^"]*)"`)
+
+// splitUserCookie undoes the packing of encryptUser, returning the ciphertext and IV
+func splitUserCookie(cookie string) ([]byte, []byte, error) {
+	packed, err := hex.DecodeString(cookie)
+	if err != nil {
+		return nil, nil, err
+	}
+	b64Ciphertext, hexIV, found := strings.Cut(string(packed), "::")
+	if !found {
+		return nil, nil, fmt.Errorf("no :: separator")
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(b64Ciphertext)
+	if err != nil {
+		return nil, nil, err
+	}
+	iv, err := hex.DecodeString(hexIV)
+	return ciphertext, iv, err
+}
+
+// packUserCookie packs a ciphertext and IV the way encryptUser does
+func packUserCookie(ciphertext []byte, iv []byte) string {
+	return hex.EncodeToString([]byte(base64.StdEncoding.EncodeToString(ciphertext) + "::" + hex.EncodeToString(iv)))
+}
+
+// xorBytes returns a XOR b, as long as the shorter of the two
+func xorBytes(a []byte, b []byte) []byte {
+	out := make([]byte, min(len(a), len(b)))
+	for i := range out {
+		out[i] = a[i] ^ b[i]
+	}
+	return out
+}
+
+// cookieSessionUser sends cookie to the site's auth_cookie without following
+// the redirect, and returns the user of the session it started, or "" if it
+// didn't authenticate anyone
+func cookieSessionUser(t *testing.T, siteURL string, dbName string, cookie string) string {
+	t.Helper()
+
+	jar, _ := cookiejar.New(nil)
+	cookieURL, _ := url.Parse(siteURL)
+	jar.SetCookies(cookieURL, []*http.Cookie{{Name: "REMOTE_USER", Value: cookie, Path: "/"}})
+
+	res, err := newAuthzClient(jar).Get(siteURL + "auth_cookie/")
+	if err != nil {
+		t.Fatalf("Could not request auth_cookie: %v", err)
+	}
+	res.Body.Close()
+
+	db := getDB()
+	defer db.Close()
+
+	for _, c := range jar.Cookies(cookieURL) {
+		rows, err := db.Query("SELECT data FROM `"+dbName+"`.sessions WHERE sessionKey = ?", c.Value)
+		if err != nil {
+			t.Fatalf("Could not read sessions: %v", err)
+		}
+		for rows.Next() {
+			var data string
+			rows.Scan(&data)
+			if m := sessionUserID.FindStringSubmatch(data); m != nil && m[1] != "" {
+				rows.Close()
+				return m[1]
+			}
+		}
+		rows.Close()
+	}
+	return ""
+}
+
+// tamperCase is a cookie and the users auth_cookie may log in as with it.
+// Logging in as no one is always allowed.
+type tamperCase struct {
+	name   string
+	cookie string
+	allow  string
+}
+
+func newTamperCases(t *testing.T) []tamperCase {
+	t.Helper()
+
+	issued, err := encryptUser(tamperUser, authCookieCipherKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, iv, err := splitUserCookie(issued)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The keystream for this IV, known to anyone who knows whose cookie it is
+	keystream := xorBytes(ciphertext, []byte(tamperUser))
+
+	var cases []tamperCase
+
+	// Bit flipping: XOR the known plaintext out and the target in
+	padded := tamperTarget + strings.Repeat(" ", len(tamperUser)-len(tamperTarget))
+	cases = append(cases,
+		tamperCase{"bit flip to the target padded with spaces", packUserCookie(xorBytes(keystream, []byte(padded)), iv), ""},
+		tamperCase{"bit flip to the target, case changed", packUserCookie(xorBytes(keystream, []byte(strings.ToUpper(tamperTarget))), iv), ""},
+	)
+	for _, pos := range []int{0, 1, len(ciphertext) / 2, len(ciphertext) - 1} {
+		single := append([]byte{}, ciphertext...)
+		single[pos] ^= 0x01
+		cases = append(cases, tamperCase{fmt.Sprintf("single bit flip at byte %d", pos), packUserCookie(single, iv), tamperUser})
+	}
+
+	// IV reuse: the keystream of the issued cookie encrypts another user
+	cases = append(cases,
+		tamperCase{"IV reused to encrypt the target", packUserCookie(xorBytes(keystream, []byte(tamperTarget)), iv), ""},
+		tamperCase{"IV reused to encrypt a prefix of the user", packUserCookie(xorBytes(keystream, []byte(tamperUser[:4])), iv), ""},
+	)
+
+	// Truncation, both of the packed cookie and of the ciphertext, which leaves a prefix of the user
+	cases = append(cases,
+		tamperCase{"cookie truncated by one hex digit", issued[:len(issued)-1], ""},
+		tamperCase{"cookie truncated by one byte", issued[:len(issued)-2], ""},
+		tamperCase{"cookie truncated to half", issued[:len(issued)/2], ""},
+		tamperCase{"cookie without the IV", hex.EncodeToString([]byte(base64.StdEncoding.EncodeToString(ciphertext) + "::")), ""},
+		tamperCase{"ciphertext truncated to 3 bytes", packUserCookie(ciphertext[:3], iv), ""},
+		tamperCase{"ciphertext truncated by one byte", packUserCookie(ciphertext[:len(ciphertext)-1], iv), ""},
+		tamperCase{"IV truncated to 8 bytes", packUserCookie(ciphertext, iv[:8]), ""},
+	)
+
+	// Separator
+	b64 := base64.StdEncoding.EncodeToString(ciphertext)
+	cases = append(cases,
+		tamperCase{"no separator", hex.EncodeToString([]byte(b64 + hex.EncodeToString(iv))), ""},
+		tamperCase{"single colon separator", hex.EncodeToString([]byte(b64 + ":" + hex.EncodeToString(iv))), ""},
+		tamperCase{"extra separator", hex.EncodeToString([]byte(b64 + "::" + hex.EncodeToString(iv) + "::" + hex.EncodeToString(iv))), ""},
+		tamperCase{"separator only", hex.EncodeToString([]byte("::")), ""},
+	)
+
+	// Empty users
+	emptyUser, _ := encryptUser("", authCookieCipherKey)
+	cases = append(cases,
+		tamperCase{"hex-encoded empty string", hex.EncodeToString([]byte("")), ""},
+		tamperCase{"encrypted empty user", emptyUser, ""},
+		tamperCase{"empty ciphertext with the issued IV", packUserCookie(nil, iv), ""},
+	)
+
+	// Wrong keys
+	for _, key := range []string{"", "wrong-key", strings.ToUpper(authCookieCipherKey), authCookieCipherKey + " "} {
+		cookie, _ := encryptUser(tamperTarget, key)
+		cases = append(cases, tamperCase{fmt.Sprintf("target encrypted with key %q", key), cookie, ""})
+	}
+
+	return cases
+}
+
+// TestAuthCookie_Tampering sends every tampered cookie to the test portal
+func TestAuthCookie_Tampering(t *testing.T) {
+	// Without a working baseline, an empty session user wouldn't mean the cookie was rejected
+	issued, err := encryptUser(tamperUser, authCookieCipherKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user := cookieSessionUser(t, RootURL, testPortalDbName, issued); !strings.EqualFold(user, tamperUser) {
+		t.Fatalf("the untampered cookie logged in as %q, want = %q", user, tamperUser)
+	}
+
+	for _, tc := range newTamperCases(t) {
+		user := cookieSessionUser(t, RootURL, testPortalDbName, tc.cookie)
+		if user != "" && !strings.EqualFold(user, tc.allow) {
+			t.Errorf("SECURITY FAILURE: %s logged in as %q\nCookie: %s", tc.name, user, tc.cookie)
+		}
+	}
+}
+
+// TestAuthCookie_ReplayToOtherPortals sends a cookie issued for the test
+// portal to the other sites. They may accept it only as the same user.
+func TestAuthCookie_ReplayToOtherPortals(t *testing.T) {
+	issued, err := encryptUser(tamperUser, authCookieCipherKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, site := range []struct {
+		url    string
+		dbName string
+	}{
+		{LibraryURL, testLibraryDbName},
+		{PlatformPrivacyURL, testPlatformPrivacyDbName},
+		{RootOrgchartURL, testNexusDbName},
+	} {
+		user := cookieSessionUser(t, site.url, site.dbName, issued)
+		if user != "" && !strings.EqualFold(user, tamperUser) {
+			t.Errorf("SECURITY FAILURE: the cookie of %s replayed to %s logged in as %q", tamperUser, site.url, user)
+		}
+		t.Logf("%s: replayed cookie logged in as %q", site.url, user)
+	}
+}
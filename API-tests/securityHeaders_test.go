@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// The security header policy in testdata/security_headers.json names the
+// header rules each route must meet, and the flags required on session and
+// REMOTE_USER cookies. A route can list rules it is known to miss under
+// accept, which keeps them in the report without failing the test.
+var securityHeadersPath = filepath.Join("testdata", "security_headers.json")
+
+var securityHeadersUpdate = flag.Bool("securityheaders.update", false, "record each route's current deviations as its accept list in testdata/security_headers.json")
+
+type headerPolicy struct {
+	Rules   map[string]headerRule `json:"rules"`
+	Cookies cookiePolicy          `json:"cookies"`
+	Routes  []headerRoute         `json:"routes"`
+}
+
+// headerRule passes if any value of any of its headers matches
+type headerRule struct {
+	Headers []string `json:"headers"`
+	Match   string   `json:"match"`
+
+	match *regexp.Regexp
+}
+
+type cookiePolicy struct {
+	Names    string   `json:"names"`
+	Secure   bool     `json:"secure"`
+	HttpOnly bool     `json:"httpOnly"`
+	SameSite []string `json:"sameSite"`
+
+	names *regexp.Regexp
+}
+
+type headerRoute struct {
+	Site   string   `json:"site"`
+	Path   string   `json:"path"`
+	Rules  []string `json:"rules"`
+	Accept []string `json:"accept,omitempty"`
+}
+
+// loadHeaderPolicy reads the policy and compiles its patterns
+func loadHeaderPolicy(path string) (headerPolicy, error) {
+	var policy headerPolicy
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return policy, err
+	}
+	if err := json.Unmarshal(b, &policy); err != nil {
+		return policy, err
+	}
+	for name, rule := range policy.Rules {
+		if rule.match, err = regexp.Compile(rule.Match); err != nil {
+			return policy, fmt.Errorf("rule %q: %v", name, err)
+		}
+		policy.Rules[name] = rule
+	}
+	if policy.Cookies.names, err = regexp.Compile(policy.Cookies.Names); err != nil {
+		return policy, fmt.Errorf("cookie names: %v", err)
+	}
+	return policy, nil
+}
+
+// writeHeaderRoutes replaces the routes in the policy file, one per line, and
+// leaves the rules and cookie policy as they are
+func writeHeaderRoutes(path string, routes []headerRoute) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	start := bytes.Index(b, []byte(`"routes": [`))
+	if start < 0 {
+		return fmt.Errorf("no routes in %s", path)
+	}
+
+	var out bytes.Buffer
+	out.Write(b[:start])
+	out.WriteString(`"routes": [`)
+	for i, route := range routes {
+		if i > 0 {
+			out.WriteString(",")
+		}
+		fmt.Fprintf(&out, "\n        {\"site\": %s, \"path\": %s, \"rules\": %s", jsonText(route.Site), jsonText(route.Path), jsonList(route.Rules))
+		if len(route.Accept) > 0 {
+			fmt.Fprintf(&out, ", \"accept\": %s", jsonList(route.Accept))
+		}
+		out.WriteString("}")
+	}
+	out.WriteString("\n    ]\n}\n")
+	return os.WriteFile(path, out.Bytes(), 0664)
+}
+
+// jsonText encodes s as a JSON string, leaving & < > as they are
+func jsonText(s string) string {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSpace(b.String())
+}
+
+func jsonList(list []string) string {
+	quoted := make([]string, len(list))
+	for i, s := range list {
+		quoted[i] = jsonText(s)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+// headerSites maps the policy's site names to the test sites
+func headerSites() map[string]string {
+	return map[string]string{
+		"portal":  RootURL,
+		"nexus":   RootOrgchartURL,
+		"library": LibraryURL,
+		"privacy": PlatformPrivacyURL,
+	}
+}
+
+func (r headerRule) check(header http.Header) bool {
+	for _, name := range r.Headers {
+		for _, value := range header.Values(name) {
+			if r.match.MatchString(value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func sameSiteName(s http.SameSite) string {
+	switch s {
+	case http.SameSiteLaxMode:
+		return "Lax"
+	case http.SameSiteStrictMode:
+		return "Strict"
+	case http.SameSiteNoneMode:
+		return "None"
+	}
+	return ""
+}
+
+// check returns the flags a Set-Cookie is missing, or nil for cookies the policy doesn't cover
+func (p cookiePolicy) check(c *http.Cookie) []string {
+	if !p.names.MatchString(c.Name) {
+		return nil
+	}
+	var missing []string
+	if p.Secure && !c.Secure {
+		missing = append(missing, "Secure")
+	}
+	if p.HttpOnly && !c.HttpOnly {
+		missing = append(missing, "HttpOnly")
+	}
+	if len(p.SameSite) > 0 && !slices.Contains(p.SameSite, sameSiteName(c.SameSite)) {
+		missing = append(missing, "SameSite="+strings.Join(p.SameSite, "|"))
+	}
+	return missing
+}
+
+// headerDeviation is a rule or cookie flag a route doesn't meet
+type headerDeviation struct {
+	what     string
+	detail   string
+	accepted bool
+}
+
+// auditRoute requests the route with a new session, so the response sets the
+// session cookie, and without following redirects, so cookies set on the way
+// to another page are seen
+func auditRoute(policy headerPolicy, route headerRoute, target string) ([]headerDeviation, error) {
+	jar, _ := cookiejar.New(nil)
+	res, err := newAuthzClient(jar).Get(target)
+	if err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+
+	var found []headerDeviation
+	for _, name := range route.Rules {
+		rule, exists := policy.Rules[name]
+		if !exists {
+			return nil, fmt.Errorf("unknown rule %q", name)
+		}
+		if !rule.check(res.Header) {
+			var got []string
+			for _, h := range rule.Headers {
+				got = append(got, fmt.Sprintf("%s: %q", h, res.Header.Get(h)))
+			}
+			found = append(found, headerDeviation{name, strings.Join(got, ", "), slices.Contains(route.Accept, name)})
+		}
+	}
+	for _, c := range res.Cookies() {
+		if missing := policy.Cookies.check(c); len(missing) > 0 {
+			what := "cookie " + c.Name
+			found = append(found, headerDeviation{what, "missing " + strings.Join(missing, ", "), slices.Contains(route.Accept, what)})
+		}
+	}
+	return found, nil
+}
+
+// TestSecurityHeaders_Policy requests every route in testdata/security_headers.json
+// and fails on deviations from the policy that the route doesn't accept. The
+// report of all deviations per route is logged either way. With
+// -securityheaders.update, each route's accept list is rewritten with its
+// current deviations instead.
+func TestSecurityHeaders_Policy(t *testing.T) {
+	policy, err := loadHeaderPolicy(securityHeadersPath)
+	if err != nil {
+		t.Fatalf("Could not load %s: %v", securityHeadersPath, err)
+	}
+
+	sites := headerSites()
+	var sb strings.Builder
+	for i, route := range policy.Routes {
+		siteURL, exists := sites[route.Site]
+		if !exists {
+			t.Errorf("Unknown site %q in %s", route.Site, securityHeadersPath)
+			continue
+		}
+		name := route.Site + " /" + truncateString(route.Path, 60)
+
+		deviations, err := auditRoute(policy, route, siteURL+route.Path)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			fmt.Fprintf(&sb, "%-70s ERROR\n", name)
+			continue
+		}
+
+		if *securityHeadersUpdate {
+			policy.Routes[i].Accept = nil
+			for _, d := range deviations {
+				policy.Routes[i].Accept = append(policy.Routes[i].Accept, d.what)
+			}
+		}
+
+		var summary []string
+		for _, d := range deviations {
+			if d.accepted || *securityHeadersUpdate {
+				summary = append(summary, d.what+" (accepted)")
+				continue
+			}
+			summary = append(summary, d.what)
+			t.Errorf("SECURITY FAILURE: %s doesn't meet %s: %s", name, d.what, d.detail)
+		}
+		result := "ok"
+		if len(summary) > 0 {
+			result = strings.Join(summary, ", ")
+		}
+		fmt.Fprintf(&sb, "%-70s %s\n", name, result)
+	}
+	t.Log("\n" + sb.String())
+
+	if *securityHeadersUpdate && !t.Failed() {
+		if err := writeHeaderRoutes(securityHeadersPath, policy.Routes); err != nil {
+			t.Fatalf("Could not write %s: %v", securityHeadersPath, err)
+		}
+	}
+}
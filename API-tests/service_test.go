@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/json"
 	"io"
 	"log"
 	"testing"
@@ -14,7 +13,7 @@ func getService(url string) ServiceResponse {
 	b, _ := io.ReadAll(res.Body)
 
 	var m ServiceResponse
-	err := json.Unmarshal(b, &m)
+	err := decodeJSON(url, b, &m)
 
 	if err != nil {
 		log.Printf("JSON parsing error, couldn't parse: %v", string(b))
@@ -28,7 +27,7 @@ func getQuad(url string) QuadResponse {
 	b, _ := io.ReadAll(res.Body)
 
 	var m QuadResponse
-	err := json.Unmarshal(b, &m)
+	err := decodeJSON(url, b, &m)
 
 	if err != nil {
 		log.Printf("JSON parsing error, couldn't parse: %v", string(b))
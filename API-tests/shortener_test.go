@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/json"
 	"io"
 	"net/http"
 	"net/url"
@@ -29,7 +28,7 @@ func TestShortener_CreateAndVerifyStorage(t *testing.T) {
 
 	body, _ := io.ReadAll(res.Body)
 	var shortCode string
-	err = json.Unmarshal(body, &shortCode)
+	err = decodeJSON(RootURL+"api/open/report", body, &shortCode)
 	if err != nil {
 		t.Fatalf("Failed to parse short code: %v, body: %s", err, string(body))
 	}
@@ -52,7 +51,7 @@ func TestShortener_CreateAndVerifyStorage(t *testing.T) {
 
 	body2, _ := io.ReadAll(res2.Body)
 	var shortCode2 string
-	json.Unmarshal(body2, &shortCode2)
+	decodeJSON(RootURL+"api/open/report", body2, &shortCode2)
 
 	if shortCode != shortCode2 {
 		t.Errorf("Expected same short code for same data (verifying DB storage). Got %s and %s", shortCode, shortCode2)
@@ -78,7 +77,7 @@ func TestShortener_FormQueryRetrievalReturnsCorrectData(t *testing.T) {
 
 	body, _ := io.ReadAll(res.Body)
 	var shortCode string
-	err = json.Unmarshal(body, &shortCode)
+	err = decodeJSON(RootURL+"api/open/form/query", body, &shortCode)
 	if err != nil {
 		t.Fatalf("Failed to parse short code: %v", err)
 	}
@@ -108,7 +107,7 @@ func TestShortener_FormQueryRetrievalReturnsCorrectData(t *testing.T) {
 
 	// Parse the response to verify it contains the expected record
 	var formQueryResult map[int]interface{}
-	err = json.Unmarshal(body, &formQueryResult)
+	err = decodeJSON(retrieveURL, body, &formQueryResult)
 	if err != nil {
 		t.Fatalf("Expected valid JSON from form query retrieval, got error: %v, body: %s", err, string(body[:min(200, len(body))]))
 	}
@@ -137,7 +136,7 @@ func TestShortener_FormQueryWithFilterData(t *testing.T) {
 
 	body, _ := io.ReadAll(res.Body)
 	var shortCode string
-	json.Unmarshal(body, &shortCode)
+	decodeJSON(RootURL+"api/open/form/query", body, &shortCode)
 
 	retrieveURL := RootURL + "api/open/form/query/_" + shortCode + "?x-filterData=recordID,title"
 	res, err = client.Get(retrieveURL)
@@ -154,7 +153,7 @@ func TestShortener_FormQueryWithFilterData(t *testing.T) {
 
 	// Parse to verify structure
 	var result map[int]map[string]interface{}
-	err = json.Unmarshal(body, &result)
+	err = decodeJSON(retrieveURL, body, &result)
 	if err != nil {
 		t.Fatalf("Failed to parse filtered results: %v", err)
 	}
@@ -203,7 +202,7 @@ func TestShortener_ReportRedirectSecurity(t *testing.T) {
 		res.Body.Close()
 
 		var shortCode string
-		err = json.Unmarshal(body, &shortCode)
+		err = decodeJSON(RootURL+"api/open/report", body, &shortCode)
 		if err != nil {
 			t.Logf("✓ Malicious URL rejected at creation: %s", maliciousURL)
 			continue
@@ -216,7 +215,7 @@ func TestShortener_ReportRedirectSecurity(t *testing.T) {
 		res2.Body.Close()
 
 		var shortCode2 string
-		json.Unmarshal(body2, &shortCode2)
+		decodeJSON(RootURL+"api/open/report", body2, &shortCode2)
 
 		if shortCode == shortCode2 {
 			t.Logf("✓ Malicious URL stored (blocking will happen on redirect): %s", maliciousURL)
@@ -253,7 +252,7 @@ func TestShortener_ReportLinkStorage(t *testing.T) {
 
 			body, _ := io.ReadAll(res.Body)
 			var shortCode string
-			err = json.Unmarshal(body, &shortCode)
+			err = decodeJSON(RootURL+"api/open/report", body, &shortCode)
 			if err != nil {
 				t.Fatalf("Failed to parse short code: %v", err)
 			}
@@ -268,7 +267,7 @@ func TestShortener_ReportLinkStorage(t *testing.T) {
 			res2.Body.Close()
 
 			var shortCode2 string
-			json.Unmarshal(body2, &shortCode2)
+			decodeJSON(RootURL+"api/open/report", body2, &shortCode2)
 
 			if shortCode != shortCode2 {
 				t.Errorf("Storage verification failed: got different codes %s and %s", shortCode, shortCode2)
@@ -296,7 +295,7 @@ func TestShortener_Deduplication(t *testing.T) {
 
 	body1, _ := io.ReadAll(res1.Body)
 	var shortCode1 string
-	json.Unmarshal(body1, &shortCode1)
+	decodeJSON(RootURL+"api/open/report", body1, &shortCode1)
 
 	// Create second link with same data
 	res2, err := client.PostForm(RootURL+"api/open/report", postData)
@@ -307,7 +306,7 @@ func TestShortener_Deduplication(t *testing.T) {
 
 	body2, _ := io.ReadAll(res2.Body)
 	var shortCode2 string
-	json.Unmarshal(body2, &shortCode2)
+	decodeJSON(RootURL+"api/open/report", body2, &shortCode2)
 
 	if shortCode1 != shortCode2 {
 		t.Errorf("Deduplication failed: expected same code, got %s and %s", shortCode1, shortCode2)
@@ -330,7 +329,7 @@ func TestShortener_ShortCodeFormat(t *testing.T) {
 
 	body, _ := io.ReadAll(res.Body)
 	var shortCode string
-	err = json.Unmarshal(body, &shortCode)
+	err = decodeJSON(RootURL+"api/open/report", body, &shortCode)
 	if err != nil {
 		t.Fatalf("Failed to parse short code: %v", err)
 	}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The SQL injection probes put boolean, time, UNION and error based payloads
+// into each parameter that reaches SQL, and report a parameter as vulnerable
+// only with evidence: true and false conditions that answer differently, a
+// delay matching the injected SLEEP, or a marker that only the database could
+// have assembled.
+
+var sqliProbes = flag.Bool("sqli", false, "run TestSQLInjection_Probes, which sends several hundred requests")
+
+// sqliMarker is built by CONCAT in the payloads, so it appears in a response
+// only if the database evaluated the payload, never from an echo of it
+const sqliMarker = "leafsqli7391"
+
+const sqliSleep = 3 * time.Second
+
+// sqliPosition is a parameter that travels into SQL
+type sqliPosition struct {
+	name string
+	url  func(payload string) string
+}
+
+func formQueryWith(q FormQuery, extra string) string {
+	return RootURL + "api/form/query?q=" + url.QueryEscape(string(marshalQuery(q))) + extra
+}
+
+func sqliTerm(term FormQueryTerm) FormQuery {
+	return FormQuery{Terms: []FormQueryTerm{term, {ID: "deleted", Operator: "=", Match: 0, Gate: "AND"}}, Joins: []string{}}
+}
+
+var sqliPositions = []sqliPosition{
+	{"terms[].match (title)", func(p string) string {
+		return formQueryWith(sqliTerm(FormQueryTerm{ID: "title", Operator: "=", Match: p, Gate: "AND"}), "")
+	}},
+	{"terms[].match (recordID)", func(p string) string {
+		return formQueryWith(sqliTerm(FormQueryTerm{ID: "recordID", Operator: "=", Match: p, Gate: "AND"}), "")
+	}},
+	{"terms[].match (data)", func(p string) string {
+		return formQueryWith(sqliTerm(FormQueryTerm{ID: "data", IndicatorID: "3", Operator: "=", Match: p, Gate: "AND"}), "")
+	}},
+	{"terms[].indicatorID", func(p string) string {
+		return formQueryWith(sqliTerm(FormQueryTerm{ID: "data", IndicatorID: p, Operator: "LIKE", Match: "*", Gate: "AND"}), "")
+	}},
+	{"terms[].operator", func(p string) string {
+		return formQueryWith(sqliTerm(FormQueryTerm{ID: "recordID", Operator: p, Match: "1", Gate: "AND"}), "")
+	}},
+	{"sort.column", func(p string) string {
+		q := sqliTerm(FormQueryTerm{ID: "recordID", Operator: "<", Match: "10", Gate: "AND"})
+		q.Sort = FormQuerySort{Column: p, Direction: "ASC"}
+		return formQueryWith(q, "")
+	}},
+	{"sort.direction", func(p string) string {
+		q := sqliTerm(FormQueryTerm{ID: "recordID", Operator: "<", Match: "10", Gate: "AND"})
+		q.Sort = FormQuerySort{Column: "recordID", Direction: p}
+		return formQueryWith(q, "")
+	}},
+	{"getData[]", func(p string) string {
+		q := sqliTerm(FormQueryTerm{ID: "recordID", Operator: "=", Match: "1", Gate: "AND"})
+		q.GetData = []string{p}
+		return formQueryWith(q, "")
+	}},
+	{"x-filterData", func(p string) string {
+		q := sqliTerm(FormQueryTerm{ID: "recordID", Operator: "<", Match: "10", Gate: "AND"})
+		return formQueryWith(q, "&x-filterData=recordID,"+url.QueryEscape(p))
+	}},
+	{"api/form/{id}/data", func(p string) string {
+		return RootURL + "api/form/" + url.PathEscape(p) + "/data"
+	}},
+	{"api/formWorkflow/{id}/currentStep", func(p string) string {
+		return RootURL + "api/formWorkflow/" + url.PathEscape(p) + "/currentStep"
+	}},
+	{"api/workflow/step/{id}", func(p string) string {
+		return RootURL + "api/workflow/step/" + url.PathEscape(p)
+	}},
+}
+
+// sqliBooleanPairs are true and false conditions that break out of string,
+// numeric and parenthesized contexts, or replace a column name
+var sqliBooleanPairs = []struct{ isTrue, isFalse string }{
+	{`1' OR '1'='1`, `1' OR '1'='2`},
+	{`1" OR "1"="1`, `1" OR "1"="2`},
+	{`1 OR 1=1`, `1 OR 1=2`},
+	{`1) OR (1=1`, `1) OR (1=2`},
+	{`recordID,(CASE WHEN 1=1 THEN recordID ELSE title END)`, `recordID,(CASE WHEN 1=2 THEN recordID ELSE title END)`},
+}
+
+var sqliTimePayloads = []string{
+	fmt.Sprintf(`1' AND SLEEP(%d) AND '1'='1`, int(sqliSleep.Seconds())),
+	fmt.Sprintf(`1" AND SLEEP(%d) AND "1"="1`, int(sqliSleep.Seconds())),
+	fmt.Sprintf(`1 AND SLEEP(%d)`, int(sqliSleep.Seconds())),
+	fmt.Sprintf(`(SELECT SLEEP(%d))`, int(sqliSleep.Seconds())),
+	fmt.Sprintf(`1' OR (SELECT 1 FROM (SELECT SLEEP(%d))x) OR '`, int(sqliSleep.Seconds())),
+}
+
+// sqliMarkerSQL evaluates to sqliMarker
+var sqliMarkerSQL = "CONCAT('leaf','sqli','7391')"
+
+func sqliUnionPayloads() []string {
+	var payloads []string
+	for columns := 1; columns <= 5; columns++ {
+		cols := sqliMarkerSQL + strings.Repeat(",NULL", columns-1)
+		payloads = append(payloads,
+			"-1' UNION SELECT "+cols+"-- ",
+			"-1 UNION SELECT "+cols+"-- ",
+		)
+	}
+	return payloads
+}
+
+var sqliErrorPayloads = []string{
+	`'`,
+	`"`,
+	`\`,
+	`')`,
+	`1'"`,
+	"1' AND EXTRACTVALUE(1,CONCAT(0x7e," + sqliMarkerSQL + "))-- ",
+	"1 AND EXTRACTVALUE(1,CONCAT(0x7e," + sqliMarkerSQL + "))",
+	"1' AND UPDATEXML(1,CONCAT(0x7e," + sqliMarkerSQL + "),1)-- ",
+}
+
+type sqliResponse struct {
+	status   int
+	body     string
+	duration time.Duration
+	err      error
+}
+
+func sqliGet(u string) sqliResponse {
+	start := time.Now()
+	res, err := client.Get(u)
+	if err != nil {
+		return sqliResponse{err: err, duration: time.Since(start)}
+	}
+	defer res.Body.Close()
+	b, _ := io.ReadAll(res.Body)
+	return sqliResponse{status: res.StatusCode, body: string(b), duration: time.Since(start)}
+}
+
+// fingerprint is what boolean probes compare: the status and the normalized
+// body, with any echo of the payload masked so error messages that repeat it
+// don't count as a difference
+func (r sqliResponse) fingerprint(payload string) string {
+	if r.err != nil {
+		return "error"
+	}
+	body, err := normalizeGolden(r.body)
+	if err != nil {
+		body = redactCSRFToken(r.body)
+	}
+	quoted, _ := json.Marshal(payload)
+	for _, echo := range []string{string(quoted[1 : len(quoted)-1]), payload, url.QueryEscape(payload), url.PathEscape(payload)} {
+		body = strings.ReplaceAll(body, echo, "<payload>")
+	}
+	return fmt.Sprintf("%d %s", r.status, body)
+}
+
+type sqliFinding struct {
+	position  string
+	technique string
+	payload   string
+	evidence  string
+}
+
+func probeBoolean(pos sqliPosition) []sqliFinding {
+	var found []sqliFinding
+	for _, pair := range sqliBooleanPairs {
+		isTrue := sqliGet(pos.url(pair.isTrue))
+		isFalse := sqliGet(pos.url(pair.isFalse))
+		if isTrue.err != nil || isFalse.err != nil || isTrue.fingerprint(pair.isTrue) == isFalse.fingerprint(pair.isFalse) {
+			continue
+		}
+
+		// Repeat the false condition, so a response that changes by itself isn't reported
+		if sqliGet(pos.url(pair.isFalse)).fingerprint(pair.isFalse) != isFalse.fingerprint(pair.isFalse) {
+			continue
+		}
+		found = append(found, sqliFinding{pos.name, "boolean", pair.isTrue, fmt.Sprintf(
+			"true condition: %d, %d bytes; false condition %q: %d, %d bytes",
+			isTrue.status, len(isTrue.body), pair.isFalse, isFalse.status, len(isFalse.body))})
+	}
+	return found
+}
+
+func probeTime(pos sqliPosition) []sqliFinding {
+	var baseline time.Duration
+	for i := 0; i < 3; i++ {
+		baseline = max(baseline, sqliGet(pos.url("1")).duration)
+	}
+	threshold := baseline + sqliSleep*5/6
+
+	var found []sqliFinding
+	for _, payload := range sqliTimePayloads {
+		first := sqliGet(pos.url(payload))
+		if first.duration < threshold {
+			continue
+		}
+		// A second slow response rules out a one-off stall
+		second := sqliGet(pos.url(payload))
+		if second.duration < threshold {
+			continue
+		}
+		found = append(found, sqliFinding{pos.name, "time", payload, fmt.Sprintf(
+			"responses took %v and %v, baseline %v", first.duration.Round(time.Millisecond), second.duration.Round(time.Millisecond), baseline.Round(time.Millisecond))})
+	}
+	return found
+}
+
+func probeMarker(pos sqliPosition, technique string, payloads []string) []sqliFinding {
+	var found []sqliFinding
+	for _, payload := range payloads {
+		res := sqliGet(pos.url(payload))
+		if res.err != nil {
+			continue
+		}
+		if i := strings.Index(res.body, sqliMarker); i >= 0 {
+			found = append(found, sqliFinding{pos.name, technique, payload, "response contains the evaluated marker: " +
+				truncateString(res.body[max(0, i-100):], 300)})
+			continue
+		}
+		if technique == "error" {
+			if m := queryFuzzSQLError.FindString(res.body); m != "" {
+				found = append(found, sqliFinding{pos.name, technique, payload, "response contains a database error: " + m})
+			}
+		}
+	}
+	return found
+}
+
+// TestSQLInjection_Probes is skipped unless -sqli is set
+func TestSQLInjection_Probes(t *testing.T) {
+	if !*sqliProbes {
+		t.Skip("set -sqli to probe for SQL injection")
+	}
+
+	var found []sqliFinding
+	for _, pos := range sqliPositions {
+		found = append(found, probeBoolean(pos)...)
+		found = append(found, probeTime(pos)...)
+		found = append(found, probeMarker(pos, "UNION", sqliUnionPayloads())...)
+		found = append(found, probeMarker(pos, "error", sqliErrorPayloads)...)
+	}
+
+	vulnerable := map[string][]string{}
+	for _, f := range found {
+		vulnerable[f.position] = append(vulnerable[f.position], f.technique)
+		t.Errorf("SECURITY FAILURE: %s is injectable (%s)\nPayload: %q\nEvidence: %s", f.position, f.technique, f.payload, f.evidence)
+	}
+
+	var sb strings.Builder
+	for _, pos := range sqliPositions {
+		result := "no evidence of injection"
+		if techniques := vulnerable[pos.name]; len(techniques) > 0 {
+			result = "VULNERABLE: " + strings.Join(techniques, ", ")
+		}
+		fmt.Fprintf(&sb, "%-36s %s\n", pos.name, result)
+	}
+	t.Log("\n" + sb.String())
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"text/tabwriter"
+	"time"
+)
+
+// SQL profiling shows which statements are behind a benchmark's latency.
+// Benchmarks and hotspot tests start it with:
+//
+//	defer profileSQL(b)()
+//
+// and it does nothing unless -sqlprofile is set:
+//
+//	go test -run="^$" -bench=Inbox -sqlprofile
+var sqlProfile = flag.Bool("sqlprofile", false, "record performance_schema statement digests around benchmarks and hotspot tests")
+var sqlProfileTop = flag.Int("sqlprofile.top", 5, "number of digests to include in each SQL profile, with EXPLAIN output")
+var sqlProfileDir = flag.String("sqlprofile.dir", "sqlprofile", "directory SQL profile reports are written to")
+
+// profiledSchemas are the databases LEAF queries while serving the test sites
+func profiledSchemas() []string {
+	return []string{testPortalDbName, testNexusDbName, testNationalNexusDbName, "national_leaf_launchpad"}
+}
+
+type sqlDigest struct {
+	Schema       string
+	DigestText   string
+	SampleText   string
+	Count        int64
+	RowsExamined int64
+	RowsSent     int64
+	TotalTime    time.Duration
+}
+
+// sqlProfileResult is what profileSQL recorded for one test or benchmark
+type sqlProfileResult struct {
+	queries      int64
+	rowsExamined int64
+	digests      []sqlDigest
+}
+
+// sqlProfiles holds the latest result per name, in the order names were first profiled
+var sqlProfiles = map[string]sqlProfileResult{}
+var sqlProfileNames []string
+var mxSQLProfiles sync.Mutex
+
+// profileSQL resets statement digests and returns a function that records the
+// statements run since. A benchmark runs once per b.N round, and each round
+// replaces the last, so the report written by writeSQLProfiles after the run
+// covers the final round. Digests are server-wide, so the report only covers
+// the test schemas and assumes nothing else is using them.
+func profileSQL(tb testing.TB) func() {
+	if !*sqlProfile {
+		return func() {}
+	}
+
+	db := getDB()
+	_, err := db.Exec(`UPDATE performance_schema.setup_consumers SET ENABLED = 'YES'
+						WHERE NAME IN ('statements_digest', 'events_statements_current', 'events_statements_history')`)
+	if err == nil {
+		_, err = db.Exec("TRUNCATE TABLE performance_schema.events_statements_summary_by_digest")
+	}
+	if err != nil {
+		tb.Logf("SQL profiling unavailable (the MySQL user needs access to performance_schema): %v", err)
+		db.Close()
+		return func() {}
+	}
+
+	if b, ok := tb.(*testing.B); ok {
+		// Setup queries run before the timer starts shouldn't count towards the profile
+		b.ResetTimer()
+	}
+
+	return func() {
+		defer db.Close()
+
+		digests, err := readSQLDigests(db)
+		if err != nil {
+			tb.Logf("Could not read statement digests: %v", err)
+			return
+		}
+
+		var queries, rowsExamined int64
+		for _, d := range digests {
+			queries += d.Count
+			rowsExamined += d.RowsExamined
+		}
+
+		if b, ok := tb.(*testing.B); ok && b.N > 0 {
+			b.ReportMetric(float64(queries)/float64(b.N), "queries/op")
+			b.ReportMetric(float64(rowsExamined)/float64(b.N), "rows-examined/op")
+		}
+
+		mxSQLProfiles.Lock()
+		defer mxSQLProfiles.Unlock()
+		if _, exists := sqlProfiles[tb.Name()]; !exists {
+			sqlProfileNames = append(sqlProfileNames, tb.Name())
+		}
+		sqlProfiles[tb.Name()] = sqlProfileResult{queries, rowsExamined, digests}
+	}
+}
+
+// writeSQLProfiles is called by TestMain after the run. It prints each
+// profile and writes it to -sqlprofile.dir.
+func writeSQLProfiles() error {
+	mxSQLProfiles.Lock()
+	defer mxSQLProfiles.Unlock()
+
+	if len(sqlProfileNames) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(*sqlProfileDir, 0775); err != nil {
+		return err
+	}
+
+	db := getDB()
+	defer db.Close()
+
+	for _, name := range sqlProfileNames {
+		p := sqlProfiles[name]
+		report := formatSQLProfile(db, name, p.queries, p.rowsExamined, p.digests)
+		fmt.Print("\n" + report)
+
+		path := filepath.Join(*sqlProfileDir, strings.ReplaceAll(name, "/", "_")+".txt")
+		if err := os.WriteFile(path, []byte(report), 0664); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readSQLDigests returns statement digests for the test schemas, slowest first
+func readSQLDigests(db *sql.DB) ([]sqlDigest, error) {
+	schemas := profiledSchemas()
+	args := make([]any, len(schemas))
+	for i, s := range schemas {
+		args[i] = s
+	}
+
+	rows, err := db.Query(`SELECT SCHEMA_NAME, COALESCE(DIGEST_TEXT, ''), COALESCE(QUERY_SAMPLE_TEXT, ''),
+								COUNT_STAR, SUM_ROWS_EXAMINED, SUM_ROWS_SENT, SUM_TIMER_WAIT
+							FROM performance_schema.events_statements_summary_by_digest
+							WHERE SCHEMA_NAME IN (?`+strings.Repeat(", ?", len(schemas)-1)+`)
+							ORDER BY SUM_TIMER_WAIT DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var digests []sqlDigest
+	for rows.Next() {
+		var d sqlDigest
+		var picoseconds uint64
+		if err := rows.Scan(&d.Schema, &d.DigestText, &d.SampleText, &d.Count, &d.RowsExamined, &d.RowsSent, &picoseconds); err != nil {
+			return nil, err
+		}
+		d.TotalTime = time.Duration(picoseconds / 1000)
+		digests = append(digests, d)
+	}
+
+	return digests, rows.Err()
+}
+
+// formatSQLProfile summarizes the digests. Statements that run far more often
+// than the test makes requests usually point to an N+1 query pattern.
+func formatSQLProfile(db *sql.DB, name string, queries int64, rowsExamined int64, digests []sqlDigest) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "SQL profile: %s\n", name)
+	fmt.Fprintf(&sb, "%d queries, %d distinct, %d rows examined\n\n", queries, len(digests), rowsExamined)
+
+	w := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "calls\trows examined\trows sent\ttotal time\tstatement")
+	for _, d := range digests[:min(*sqlProfileTop, len(digests))] {
+		fmt.Fprintf(w, "%d\t%d\t%d\t%v\t%s\n", d.Count, d.RowsExamined, d.RowsSent, d.TotalTime.Round(time.Microsecond), truncateString(d.DigestText, 200))
+	}
+	w.Flush()
+
+	for i, d := range digests[:min(*sqlProfileTop, len(digests))] {
+		fmt.Fprintf(&sb, "\n#%d EXPLAIN %s\n", i+1, truncateString(d.DigestText, 200))
+		sb.WriteString(explainSQL(db, d))
+	}
+
+	return sb.String()
+}
+
+// explainSQL runs EXPLAIN on a digest's sample statement in the schema it ran against
+func explainSQL(db *sql.DB, d sqlDigest) string {
+	sample := strings.TrimSpace(d.SampleText)
+	if !strings.HasPrefix(strings.ToUpper(sample), "SELECT") {
+		return "(only SELECT statements are explained)\n"
+	}
+
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err.Error() + "\n"
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "USE "+d.Schema); err != nil {
+		return err.Error() + "\n"
+	}
+	rows, err := conn.QueryContext(ctx, "EXPLAIN "+sample)
+	if err != nil {
+		// Samples are truncated at performance_schema_max_sql_text_length
+		return "(could not explain sample: " + err.Error() + ")\n"
+	}
+	defer rows.Close()
+
+	columns, _ := rows.Columns()
+	var sb strings.Builder
+	w := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(columns, "\t"))
+
+	values := make([]sql.NullString, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return err.Error() + "\n"
+		}
+		cells := make([]string, len(values))
+		for i, v := range values {
+			cells[i] = "NULL"
+			if v.Valid {
+				cells[i] = v.String
+			}
+		}
+		fmt.Fprintln(w, strings.Join(cells, "\t"))
+	}
+	w.Flush()
+
+	return sb.String()
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// exchange is one HTTP request made by the suite and its response
+type exchange struct {
+	Request      *http.Request
+	RequestBody  []byte
+	Response     *http.Response // nil if the request failed
+	ResponseBody []byte
+	Duration     time.Duration
+	Err          error
+}
+
+// trafficObserver is called after every request made through observedTransport
+type trafficObserver func(ex *exchange)
+
+var trafficObservers []trafficObserver
+var mxTrafficObservers sync.RWMutex
+
+// observeTraffic registers an observer. Bodies are only buffered while at least
+// one observer is registered, so the suite runs unchanged otherwise.
+func observeTraffic(o trafficObserver) {
+	mxTrafficObservers.Lock()
+	defer mxTrafficObservers.Unlock()
+
+	trafficObservers = append(trafficObservers, o)
+}
+
+// observedTransport wraps a transport and shows each exchange to the registered observers
+type observedTransport struct {
+	base http.RoundTripper
+}
+
+func (t *observedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	mxTrafficObservers.RLock()
+	observers := trafficObservers
+	mxTrafficObservers.RUnlock()
+
+	if len(observers) == 0 {
+		return t.base.RoundTrip(req)
+	}
+
+	// RoundTrip must not modify req, so the body is read from a copy
+	sent := req
+	ex := &exchange{Request: req}
+	if req.Body != nil && req.Body != http.NoBody {
+		body := req.Body
+		if req.GetBody != nil {
+			if b, err := req.GetBody(); err == nil {
+				req.Body.Close()
+				body = b
+			}
+		}
+		ex.RequestBody, _ = io.ReadAll(body)
+		body.Close()
+
+		sent = req.Clone(req.Context())
+		sent.Body = io.NopCloser(bytes.NewReader(ex.RequestBody))
+		ex.Request = sent
+	}
+
+	start := time.Now()
+	res, err := t.base.RoundTrip(sent)
+	ex.Err = err
+	if res != nil {
+		ex.ResponseBody, _ = io.ReadAll(res.Body)
+		res.Body.Close()
+		res.Body = io.NopCloser(bytes.NewReader(ex.ResponseBody))
+		ex.Response = res
+	}
+	ex.Duration = time.Since(start)
+
+	for _, o := range observers {
+		o(ex)
+	}
+
+	return res, err
+}
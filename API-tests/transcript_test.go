@@ -0,0 +1,210 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+// A failing assertion doesn't show what was sent or received, so the last
+// requests of each test are kept and printed only if the test fails. The same
+// transcript is written to transcripts/<test>.txt for CI to keep as an artifact.
+var transcriptSize = flag.Int("transcript.size", 20, "number of recent requests shown when a test fails, 0 to disable")
+var transcriptBody = flag.Int("transcript.body", 2000, "truncate request and response bodies in transcripts to this many bytes")
+var transcriptDir = flag.String("transcript.dir", "transcripts", "directory for the transcripts of failed tests")
+
+// transcriptRedactedHeaders carry credentials: the session cookie and the encrypted REMOTE_USER
+var transcriptRedactedHeaders = map[string]bool{
+	"Cookie":     true,
+	"Set-Cookie": true,
+}
+
+var csrfTokenValue = regexp.MustCompile(`(CSRFToken=)[^&]*`)
+
+// transcript is a ring buffer of the most recent exchanges of the running test
+type transcript struct {
+	mu      sync.Mutex
+	test    string
+	entries []string
+	next    int
+	dropped int
+}
+
+var currentTranscript transcript
+var transcriptObserverOnce sync.Once
+
+// runningTest names the current top-level test for observers that label traffic
+var runningTest string
+
+// trackTests makes every top-level test and fuzz target in m start with
+// trackTest, so tests don't have to call it themselves. testing.M doesn't
+// expose them, so TestMain reaches its unexported fields.
+func trackTests(m *testing.M) {
+	tests := testingMField[[]testing.InternalTest](m, "tests")
+	for i, test := range *tests {
+		(*tests)[i].F = func(t *testing.T) {
+			trackTest(t)
+			test.F(t)
+		}
+	}
+	targets := testingMField[[]testing.InternalFuzzTarget](m, "fuzzTargets")
+	for i, target := range *targets {
+		(*targets)[i].Fn = func(f *testing.F) {
+			trackTest(f)
+			target.Fn(f)
+		}
+	}
+}
+
+func testingMField[T any](m *testing.M, name string) *T {
+	field := reflect.ValueOf(m).Elem().FieldByName(name)
+	if !field.IsValid() || field.Type() != reflect.TypeFor[T]() {
+		log.Fatalf("testing.M has no %s field of type %v", name, reflect.TypeFor[T]())
+	}
+	return (*T)(unsafe.Pointer(field.UnsafeAddr()))
+}
+
+// trackTest starts a transcript and a cassette for t. Tests in this suite
+// don't run in parallel, so requests made until t finishes belong to t.
+func trackTest(t testing.TB) {
+	runningTest = t.Name()
+	startCassette(t.Name())
+	t.Cleanup(finishCassette)
+
+	if *transcriptSize <= 0 {
+		return
+	}
+	transcriptObserverOnce.Do(func() {
+		observeTraffic(currentTranscript.record)
+	})
+
+	currentTranscript.reset(t.Name())
+	t.Cleanup(func() {
+		if !t.Failed() {
+			return
+		}
+		dump := currentTranscript.String()
+		t.Logf("HTTP transcript:\n%s", dump)
+
+		if err := os.MkdirAll(*transcriptDir, 0775); err != nil {
+			t.Logf("Could not create %s: %v", *transcriptDir, err)
+			return
+		}
+		path := filepath.Join(*transcriptDir, strings.ReplaceAll(t.Name(), "/", "_")+".txt")
+		if err := os.WriteFile(path, []byte(dump), 0664); err != nil {
+			t.Logf("Could not write %s: %v", path, err)
+		}
+	})
+}
+
+func (tr *transcript) reset(test string) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	tr.test = test
+	tr.entries = make([]string, 0, *transcriptSize)
+	tr.next = 0
+	tr.dropped = 0
+}
+
+// record is a trafficObserver
+func (tr *transcript) record(ex *exchange) {
+	entry := formatExchange(ex)
+
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	if tr.test == "" {
+		return
+	}
+	if len(tr.entries) < cap(tr.entries) {
+		tr.entries = append(tr.entries, entry)
+		return
+	}
+	tr.entries[tr.next] = entry
+	tr.next = (tr.next + 1) % len(tr.entries)
+	tr.dropped++
+}
+
+// String lists the buffered exchanges, oldest first
+func (tr *transcript) String() string {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "== %s: last %d request(s)", tr.test, len(tr.entries))
+	if tr.dropped > 0 {
+		fmt.Fprintf(&sb, ", %d earlier request(s) not shown", tr.dropped)
+	}
+	sb.WriteString("\n")
+	for i := range tr.entries {
+		sb.WriteString(tr.entries[(tr.next+i)%len(tr.entries)])
+	}
+	return sb.String()
+}
+
+// formatExchange describes one request and response with credentials redacted
+func formatExchange(ex *exchange) string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "\n%s %s %s (%s)\n", ex.Request.Method, redactCSRFToken(ex.Request.URL.String()),
+		time.Now().Add(-ex.Duration).Format("15:04:05.000"), ex.Duration.Round(time.Millisecond))
+	writeHeaders(&sb, ex.Request.Header)
+	if len(ex.RequestBody) > 0 {
+		body := string(ex.RequestBody)
+		if strings.HasPrefix(ex.Request.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+			body = redactCSRFToken(body)
+		}
+		fmt.Fprintf(&sb, "\n%s\n", truncateString(body, *transcriptBody))
+	}
+
+	if ex.Err != nil {
+		fmt.Fprintf(&sb, "--> error: %v\n", ex.Err)
+		return sb.String()
+	}
+	fmt.Fprintf(&sb, "--> %s\n", ex.Response.Status)
+	writeHeaders(&sb, ex.Response.Header)
+	if len(ex.ResponseBody) > 0 {
+		fmt.Fprintf(&sb, "\n%s\n", truncateString(string(ex.ResponseBody), *transcriptBody))
+	}
+
+	return sb.String()
+}
+
+func writeHeaders(sb *strings.Builder, h http.Header) {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value := strings.Join(h[name], ", ")
+		if transcriptRedactedHeaders[name] {
+			value = "<redacted>"
+		}
+		fmt.Fprintf(sb, "    %s: %s\n", name, value)
+	}
+}
+
+// redactCSRFToken hides CSRFToken in a URL or form body
+func redactCSRFToken(s string) string {
+	s = csrfTokenValue.ReplaceAllString(s, "${1}<redacted>")
+	if CsrfToken != "" {
+		s = strings.ReplaceAll(s, CsrfToken, "<redacted>")
+		s = strings.ReplaceAll(s, url.QueryEscape(CsrfToken), "<redacted>")
+	}
+	return s
+}
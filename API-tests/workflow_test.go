@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/json"
 	"io"
 	"log"
 	"net/url"
@@ -31,12 +30,13 @@ var commonDependencies = WorkflowDependencies{
 }
 
 func getWorkflowStep(stepID string) WorkflowStep {
-	res, _ := client.Get(RootURL + "api/workflow/step/" + stepID)
+	url := RootURL + "api/workflow/step/" + stepID
+	res, _ := client.Get(url)
 	b, _ := io.ReadAll(res.Body)
 	defer res.Body.Close()
 
 	var m WorkflowStep
-	err := json.Unmarshal(b, &m)
+	err := decodeJSON(url, b, &m)
 	if err != nil {
 		log.Printf("JSON parsing error, couldn't parse: %v", string(b))
 		log.Printf("JSON parsing error: %v", err.Error())
@@ -45,12 +45,13 @@ func getWorkflowStep(stepID string) WorkflowStep {
 }
 
 func getWorkflowStepDependencies(stepID string) WorkflowStepDependencies {
-	res, _ := client.Get(RootURL + "api/workflow/step/" + stepID + "/dependencies")
+	url := RootURL + "api/workflow/step/" + stepID + "/dependencies"
+	res, _ := client.Get(url)
 	b, _ := io.ReadAll(res.Body)
 	defer res.Body.Close()
 
 	var m WorkflowStepDependencies
-	err := json.Unmarshal(b, &m)
+	err := decodeJSON(url, b, &m)
 	if err != nil {
 		log.Printf("JSON parsing error, couldn't parse: %v", string(b))
 		log.Printf("JSON parsing error: %v", err.Error())
@@ -70,7 +71,7 @@ func setStepCoordinates(workflowID string, stepID string, x string, y string) st
 	defer res.Body.Close()
 
 	var c string
-	err := json.Unmarshal(bodyBytes, &c)
+	err := decodeJSON(res.Request.URL.String(), bodyBytes, &c)
 	if err != nil {
 		log.Printf("JSON parsing error, couldn't parse: %v", string(bodyBytes))
 	}
@@ -123,7 +124,7 @@ func TestWorkflow_Step_Actions(t *testing.T) {
 	defer res.Body.Close()
 
 	var data StepActions
-	err := json.Unmarshal(b, &data)
+	err := decodeJSON(res.Request.URL.String(), b, &data)
 	if err != nil {
 		t.Errorf("JSON parsing error, couldn't parse: %v", string(b))
 	}
@@ -173,7 +174,7 @@ func TestWorkflow_NewWorkflow(t *testing.T) {
 	defer res.Body.Close()
 
 	var workflowID string
-	err := json.Unmarshal(b, &workflowID)
+	err := decodeJSON(res.Request.URL.String(), b, &workflowID)
 	if err != nil {
 		t.Errorf("JSON parsing error, couldn't parse: %v", string(b))
 	}
@@ -202,7 +203,7 @@ func TestWorkflow_NewWorkflowStep(t *testing.T) {
 	defer res.Body.Close()
 
 	var stepID string
-	err := json.Unmarshal(b, &stepID)
+	err := decodeJSON(res.Request.URL.String(), b, &stepID)
 	if err != nil {
 		t.Errorf("JSON parsing error, couldn't parse: %v", string(b))
 	}
@@ -237,7 +238,7 @@ func TestWorkflow_NewDependency(t *testing.T) {
 	defer res.Body.Close()
 
 	var dependencyID string
-	err := json.Unmarshal(b, &dependencyID)
+	err := decodeJSON(res.Request.URL.String(), b, &dependencyID)
 	if err != nil {
 		t.Errorf("JSON parsing error, couldn't parse: %v", string(b))
 	}
@@ -275,7 +276,7 @@ func TestWorkflow_LinkStepDependenciesToWorkflowStep(t *testing.T) {
 		defer res.Body.Close()
 
 		var result string
-		err := json.Unmarshal(b, &result)
+		err := decodeJSON(res.Request.URL.String(), b, &result)
 		if err != nil {
 			t.Errorf("JSON parsing error, couldn't parse: %v", string(b))
 		}
@@ -308,7 +309,7 @@ func TestWorkflow_SetCustomDependencyGroupPrivileges(t *testing.T) {
 	defer res.Body.Close()
 
 	var result string
-	err := json.Unmarshal(b, &result)
+	err := decodeJSON(res.Request.URL.String(), b, &result)
 	if err != nil {
 		t.Errorf("JSON parsing error, couldn't parse: %v", string(b))
 	}
@@ -338,7 +339,7 @@ func TestWorkflow_SetStepPersonDesignatedField(t *testing.T) {
 	defer res.Body.Close()
 
 	var result string
-	err := json.Unmarshal(b, &result)
+	err := decodeJSON(res.Request.URL.String(), b, &result)
 	if err != nil {
 		t.Errorf("JSON parsing error, couldn't parse: %v", string(b))
 	}
@@ -368,7 +369,7 @@ func TestWorkflow_SetStepGroupDesignatedField(t *testing.T) {
 	defer res.Body.Close()
 
 	var result string
-	err := json.Unmarshal(b, &result)
+	err := decodeJSON(res.Request.URL.String(), b, &result)
 	if err != nil {
 		t.Errorf("JSON parsing error, couldn't parse: %v", string(b))
 	}
@@ -484,7 +485,7 @@ func TestWorkflow_UnlinkStepDependenciesFromWorkflowStep(t *testing.T) {
 		defer res.Body.Close()
 
 		var result string
-		err = json.Unmarshal(b, &result)
+		err = decodeJSON(res.Request.URL.String(), b, &result)
 		if err != nil {
 			t.Errorf("JSON parsing error, couldn't parse: %v", string(b))
 		}
@@ -542,7 +543,7 @@ func TestWorkflow_DeleteWorkflowStep(t *testing.T) {
 	defer res.Body.Close()
 
 	var result string
-	err = json.Unmarshal(b, &result)
+	err = decodeJSON(res.Request.URL.String(), b, &result)
 	if err != nil {
 		t.Errorf("JSON parsing error, couldn't parse: %v", string(b))
 	}
@@ -580,7 +581,7 @@ func TestWorkflow_DeleteWorkflow(t *testing.T) {
 	defer res.Body.Close()
 
 	var result string
-	err = json.Unmarshal(b, &result)
+	err = decodeJSON(res.Request.URL.String(), b, &result)
 	if err != nil {
 		t.Errorf("JSON parsing error, couldn't parse: %v", string(b))
 	}
@@ -620,7 +621,7 @@ func TestWorkflow_NewAction_CreationAndInputValidation(t *testing.T) {
 	defer res.Body.Close()
 
 	var a []Action
-	err = json.Unmarshal(b, &a)
+	err = decodeJSON(res.Request.URL.String(), b, &a)
 	if err != nil {
 		log.Printf("JSON parsing error, couldn't parse: %v", string(b))
 		log.Printf("JSON parsing error: %v", err.Error())
@@ -693,7 +694,7 @@ func TestWorkflow_EditAction(t *testing.T) {
 	defer res.Body.Close()
 
 	var a []Action
-	err = json.Unmarshal(b, &a)
+	err = decodeJSON(res.Request.URL.String(), b, &a)
 	if err != nil {
 		log.Printf("JSON parsing error, couldn't parse: %v", string(b))
 		log.Printf("JSON parsing error: %v", err.Error())
@@ -753,7 +754,7 @@ func TestWorkflow_DeleteAction(t *testing.T) {
 	defer res.Body.Close()
 
 	var result string
-	err = json.Unmarshal(b, &result)
+	err = decodeJSON(res.Request.URL.String(), b, &result)
 	if err != nil {
 		t.Errorf("JSON parsing error, couldn't parse: %v", string(b))
 	}
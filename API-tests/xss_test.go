@@ -0,0 +1,365 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// The stored XSS suite writes each payload in xssPayloads to a user-editable
+// field, reads it back from every endpoint that shows the field, and checks
+// what comes back against the field's contract.
+
+// xssPayloads are stored XSS payloads, including ones written to get past
+// filters that strip or match tags naively
+var xssPayloads = []string{
+	`<script>alert(1)</script>`,
+	`<img src=x onerror=alert(1)>`,
+	`<svg onload=alert(1)>`,
+	`"><script>alert(1)</script>`,
+	`'><img src=x onerror=alert(1)>`,
+	`<a href="javascript:alert(1)">link</a>`,
+	`<iframe src="javascript:alert(1)"></iframe>`,
+	`<body onload=alert(1)>`,
+	`<scr<script>ipt>alert(1)</scr</script>ipt>`,
+	`<a href="JaVaScRiPt:alert(1)">link</a>`,
+	`&lt;script&gt;alert(1)&lt;/script&gt;`,
+	`<details open ontoggle=alert(1)>`,
+	`<math><mtext><table><mglyph><style><img src=x onerror=alert(1)>`,
+}
+
+// xssContract is what a field may return
+type xssContract int
+
+const (
+	// xssText fields are plain text, and may not contain any tag
+	xssText xssContract = iota
+	// xssHTML fields allow formatting, but nothing that runs script
+	xssHTML
+)
+
+func (c xssContract) String() string {
+	if c == xssHTML {
+		return "html"
+	}
+	return "text"
+}
+
+var xssAnyTag = regexp.MustCompile(`(?i)<\s*/?\s*[a-z!?]`)
+var xssUnsafeTag = regexp.MustCompile(`(?i)<\s*/?\s*(script|iframe|frame|frameset|object|embed|applet|svg|math|base|meta|link|style|form)\b`)
+var xssEventHandler = regexp.MustCompile(`(?i)<[^>]*\son[a-z]+\s*=`)
+var xssScriptURL = regexp.MustCompile(`(?i)(javascript|vbscript)\s*:|data\s*:\s*text/html`)
+
+// violation returns why value breaks the contract, or "" if it doesn't
+func (c xssContract) violation(value string) string {
+	if c == xssText {
+		if m := xssAnyTag.FindString(value); m != "" {
+			return fmt.Sprintf("contains a tag (%q)", m)
+		}
+		return ""
+	}
+	if m := xssUnsafeTag.FindString(value); m != "" {
+		return fmt.Sprintf("contains an unsafe tag (%q)", m)
+	}
+	if m := xssEventHandler.FindString(value); m != "" {
+		return fmt.Sprintf("contains an event handler (%q)", m)
+	}
+	// A script URL is only dangerous inside a tag
+	for _, tag := range regexp.MustCompile(`<[^>]*>`).FindAllString(value, -1) {
+		if m := xssScriptURL.FindString(tag); m != "" {
+			return fmt.Sprintf("contains a script URL (%q)", m)
+		}
+	}
+	return ""
+}
+
+// xssField is a user-editable field. write stores value and returns the URLs
+// that show it; a write that LEAF rejects returns an error.
+type xssField struct {
+	name     string
+	contract xssContract
+	write    func(t *testing.T, value string) ([]string, error)
+}
+
+// xssPost posts data and returns the decoded response, which for creates is the new ID
+func xssPost(u string, data url.Values) (string, error) {
+	data.Set("CSRFToken", CsrfToken)
+	res, err := client.PostForm(u, data)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	b, _ := io.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("status %v: %v", res.StatusCode, truncateString(string(b), 200))
+	}
+
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		return "", fmt.Errorf("unexpected response: %v", truncateString(string(b), 200))
+	}
+	return fmt.Sprint(v), nil
+}
+
+// xssDelete removes something the suite created through its DELETE endpoint
+func xssDelete(t *testing.T, u string) {
+	sep := "?"
+	if strings.Contains(u, "?") {
+		sep = "&"
+	}
+	req, err := http.NewRequest("DELETE", u+sep+"CSRFToken="+url.QueryEscape(CsrfToken), nil)
+	if err != nil {
+		t.Errorf("Could not delete %s: %v", u, err)
+		return
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		t.Errorf("Could not delete %s: %v", u, err)
+		return
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("Could not delete %s: status %v", u, res.StatusCode)
+	}
+}
+
+// xssDeleteForm removes a form and its indicators from the database, since
+// LEAF only disables deleted forms and indicators
+func xssDeleteForm(t *testing.T, categoryID string) {
+	db := getDB()
+	defer db.Close()
+
+	for _, table := range []string{"indicators", "categories"} {
+		if _, err := db.Exec("DELETE FROM "+testPortalDbName+"."+table+" WHERE categoryID = ?", categoryID); err != nil {
+			t.Errorf("Could not delete form %s from %s: %v", categoryID, table, err)
+		}
+	}
+}
+
+func xssCreateIndicator(categoryID string, name string) (string, error) {
+	id, err := xssPost(RootURL+"api/formEditor/newIndicator", url.Values{
+		"name":       {name},
+		"format":     {"text"},
+		"categoryID": {categoryID},
+	})
+	if err == nil && id == "" {
+		err = fmt.Errorf("no indicatorID")
+	}
+	return id, err
+}
+
+// newXSSFields creates the form and workflow that hold the suite's indicators
+// and steps, and returns every field under test
+func newXSSFields(t *testing.T) []xssField {
+	categoryID := postNewForm()
+	workflowID, err := xssPost(RootURL+"api/workflow/new", url.Values{"description": {"XSS suite"}})
+	if categoryID == "" || err != nil {
+		t.Fatalf("Could not create the form and workflow for the suite: %q, %v", categoryID, err)
+	}
+	// The form's cleanup also removes every indicator the suite creates in it
+	t.Cleanup(func() { xssDeleteForm(t, categoryID) })
+	t.Cleanup(func() { xssDelete(t, RootURL+"api/workflow/"+workflowID) })
+
+	indicatorReads := func(indicatorID string) []string {
+		return []string{
+			RootURL + "api/form/_" + categoryID,
+			RootURL + "api/form/indicator/list?forms=" + categoryID,
+			RootURL + "api/formEditor/indicator/" + indicatorID,
+		}
+	}
+	indicatorField := func(field string) func(t *testing.T, value string) ([]string, error) {
+		return func(t *testing.T, value string) ([]string, error) {
+			id, err := xssCreateIndicator(categoryID, "XSS suite")
+			if err != nil {
+				return nil, err
+			}
+			if _, err := xssPost(RootURL+"api/formEditor/"+id+"/"+field, url.Values{field: {value}}); err != nil {
+				return nil, err
+			}
+			return indicatorReads(id), nil
+		}
+	}
+
+	eventCount := 0
+	return []xssField{
+		{"indicator name", xssHTML, func(t *testing.T, value string) ([]string, error) {
+			id, err := xssCreateIndicator(categoryID, value)
+			if err != nil {
+				return nil, err
+			}
+			return indicatorReads(id), nil
+		}},
+		{"indicator description", xssText, indicatorField("description")},
+		{"indicator html", xssHTML, indicatorField("html")},
+		{"indicator htmlPrint", xssHTML, indicatorField("htmlPrint")},
+		{"form name", xssText, func(t *testing.T, value string) ([]string, error) {
+			formID, err := xssPost(RootURL+"api/formEditor/new", url.Values{"name": {value}, "description": {"XSS suite"}})
+			if err != nil {
+				return nil, err
+			}
+			t.Cleanup(func() { xssDeleteForm(t, formID) })
+			return []string{RootURL + "api/formStack/categoryList/all"}, nil
+		}},
+		{"form description", xssText, func(t *testing.T, value string) ([]string, error) {
+			formID, err := xssPost(RootURL+"api/formEditor/new", url.Values{"name": {"XSS suite"}, "description": {value}})
+			if err != nil {
+				return nil, err
+			}
+			t.Cleanup(func() { xssDeleteForm(t, formID) })
+			return []string{RootURL + "api/formStack/categoryList/all"}, nil
+		}},
+		{"step title", xssText, func(t *testing.T, value string) ([]string, error) {
+			stepID, err := xssPost(RootURL+"api/workflow/"+workflowID+"/step", url.Values{"stepTitle": {value}})
+			if err != nil {
+				return nil, err
+			}
+			t.Cleanup(func() { xssDelete(t, RootURL+"api/workflow/step/"+stepID) })
+			return []string{
+				RootURL + "api/workflow/step/" + stepID,
+				RootURL + "api/workflow/" + workflowID,
+			}, nil
+		}},
+		{"event description", xssText, func(t *testing.T, value string) ([]string, error) {
+			eventCount++
+			name := fmt.Sprintf("CustomEvent_xss_suite_%d", eventCount)
+			if _, err := postEvent(RootURL+"api/workflow/events", WorkflowEvent{EventID: name, EventDescription: value, EventType: "Email"}, map[string]string{}); err != nil {
+				return nil, err
+			}
+			t.Cleanup(func() { xssDelete(t, RootURL+"api/workflow/event/_"+name) })
+			return []string{
+				RootURL + "api/workflow/event/_" + name,
+				RootURL + "api/emailTemplates",
+			}, nil
+		}},
+		{"email template body", xssHTML, func(t *testing.T, value string) ([]string, error) {
+			eventCount++
+			return xssWriteTemplate(t, fmt.Sprintf("CustomEvent_xss_suite_%d", eventCount), value, "XSS suite")
+		}},
+		{"email template subject", xssText, func(t *testing.T, value string) ([]string, error) {
+			eventCount++
+			return xssWriteTemplate(t, fmt.Sprintf("CustomEvent_xss_suite_%d", eventCount), "XSS suite", value)
+		}},
+		{"group title", xssText, func(t *testing.T, value string) ([]string, error) {
+			groupID, err := xssPost(RootOrgchartURL+"api/group", url.Values{"title": {value}})
+			if err != nil {
+				return nil, err
+			}
+			t.Cleanup(func() {
+				removeFromNexus(RootOrgchartURL+"api/group/"+groupID+"?CSRFToken="+url.QueryEscape(CsrfToken), "")
+			})
+			return []string{
+				RootOrgchartURL + "api/group/list",
+				RootOrgchartURL + "api/group/" + groupID,
+			}, nil
+		}},
+		{"service name", xssText, func(t *testing.T, value string) ([]string, error) {
+			serviceID, err := xssPost(RootURL+"api/service", url.Values{"service": {value}, "groupID": {"1"}})
+			if err != nil {
+				return nil, err
+			}
+			t.Cleanup(func() { xssDelete(t, RootURL+"api/service/"+serviceID) })
+			return []string{
+				RootURL + "api/service",
+				RootURL + "api/service/members",
+			}, nil
+		}},
+	}
+}
+
+// xssWriteTemplate creates the custom event name and stores body and subject as its template
+func xssWriteTemplate(t *testing.T, name string, body string, subject string) ([]string, error) {
+	if _, err := postEvent(RootURL+"api/workflow/events", WorkflowEvent{EventID: name, EventDescription: "XSS suite", EventType: "Email"}, map[string]string{}); err != nil {
+		return nil, err
+	}
+	t.Cleanup(func() { xssDelete(t, RootURL+"api/workflow/event/_"+name) })
+	if _, err := xssPost(RootURL+"api/emailTemplates/_"+name+"_body.tpl", url.Values{
+		"file":            {body},
+		"subjectFile":     {subject},
+		"subjectFileName": {name + "_subject.tpl"},
+		"emailToFile":     {""},
+		"emailToFileName": {name + "_emailTo.tpl"},
+		"emailCcFile":     {""},
+		"emailCcFileName": {name + "_emailCc.tpl"},
+	}); err != nil {
+		return nil, err
+	}
+	t.Cleanup(func() {
+		xssDelete(t, RootURL+"api/emailTemplates/_"+name+"_body.tpl?subjectFileName="+name+"_subject.tpl&emailToFileName="+name+"_emailTo.tpl&emailCcFileName="+name+"_emailCc.tpl")
+	})
+	return []string{RootURL + "api/emailTemplates/_" + name + "_body.tpl"}, nil
+}
+
+// xssFindMarked returns every string in a response that contains marker
+func xssFindMarked(body string, marker string) []string {
+	var v any
+	if err := json.Unmarshal([]byte(body), &v); err != nil {
+		if strings.Contains(body, marker) {
+			return []string{body}
+		}
+		return nil
+	}
+
+	var found []string
+	var walk func(v any)
+	walk = func(v any) {
+		switch val := v.(type) {
+		case string:
+			if strings.Contains(val, marker) {
+				found = append(found, val)
+			}
+		case map[string]any:
+			for _, child := range val {
+				walk(child)
+			}
+		case []any:
+			for _, child := range val {
+				walk(child)
+			}
+		}
+	}
+	walk(v)
+	return found
+}
+
+// TestXSS_StoredFields writes every payload to every field. A write LEAF
+// rejects is safe; a write it accepts must read back within the field's
+// contract from every endpoint that shows it.
+func TestXSS_StoredFields(t *testing.T) {
+	n := 0
+	for _, field := range newXSSFields(t) {
+		for _, payload := range xssPayloads {
+			// The marker finds the stored value in responses, whatever happened to the payload
+			n++
+			marker := fmt.Sprintf("xssmark%d", n)
+
+			reads, err := field.write(t, marker+" "+payload)
+			if err != nil {
+				t.Logf("%s rejected %q: %v", field.name, payload, err)
+				continue
+			}
+
+			for _, u := range reads {
+				body, res := httpGet(u)
+				if res == nil {
+					t.Errorf("%s: could not read %s", field.name, u)
+					continue
+				}
+				values := xssFindMarked(body, marker)
+				if len(values) == 0 {
+					t.Errorf("%s: %s doesn't show the stored value of %q", field.name, strings.TrimPrefix(u, HostURL), payload)
+				}
+				for _, value := range values {
+					if problem := field.contract.violation(value); problem != "" {
+						t.Errorf("SECURITY FAILURE: %s (%v) %s in %s\nPayload: %q\nStored: %q",
+							field.name, field.contract, problem, strings.TrimPrefix(u, HostURL), payload, truncateString(value, 300))
+					}
+				}
+			}
+		}
+	}
+}
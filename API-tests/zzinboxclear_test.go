@@ -21,7 +21,7 @@ func ClearInbox() error {
 		return fmt.Errorf("error creating request: %w", err)
 	}
 
-	client := &http.Client{}
+	client := &http.Client{Transport: suiteTransport}
 	resp, err := client.Do(req)
 	if err != nil {
 		return fmt.Errorf("error sending request: %w", err)
@@ -44,7 +44,7 @@ func GetMessageCount() (int, error) {
 		return 0, fmt.Errorf("error creating request: %w", err)
 	}
 
-	client := &http.Client{}
+	client := &http.Client{Transport: suiteTransport}
 	resp, err := client.Do(req)
 	if err != nil {
 		return 0, fmt.Errorf("error sending request: %w", err)
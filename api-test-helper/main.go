@@ -15,6 +15,7 @@ func main() {
 	http.HandleFunc("/api/v1/test", handleRunTest)
 	http.HandleFunc("/api/v1/testLLM", handleRunTestLLM)
 	http.HandleFunc("/api/v1/benchLLM", handleBenchLLM)
+	http.HandleFunc("/api/v1/testUpgrade", handleRunUpgradeTest)
 
 	http.ListenAndServe(":8000", nil)
 }
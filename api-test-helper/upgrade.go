@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// upgradeArchiveDir holds one directory per release, each containing that
+// release's portal_test_db.sql and nexus_test_db.sql
+const upgradeArchiveDir = "../API-tests/database/archive/"
+
+// upgradeSmokeTests is the subset of API tests run against each upgraded database.
+// These only read core data, so they pass against any archived fixture derived
+// from API-tests/database.
+const upgradeSmokeTests = "^(TestFormQuery_HomepageQuery|TestFormQuery_NonadminQuery|TestForm_Version|TestFormStack_Version|" +
+	"TestFormWorkflow_currentStepPersonDesignatedAndGroup|TestWorkflow_GetStepDependencyConfig|" +
+	"TestEmployee_CheckNationalEmployee|TestService_getMembers|TestPlatform_getOrgchartTags)$"
+
+var failedTestPattern = regexp.MustCompile(`--- FAIL: (\S+)`)
+
+type upgradeResult struct {
+	Version     string
+	Status      string
+	FailedTests []string
+}
+
+// upgradeVersions lists archived releases that have both a portal and nexus dump
+func upgradeVersions() ([]string, error) {
+	entries, err := os.ReadDir(upgradeArchiveDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		dir := filepath.Join(upgradeArchiveDir, e.Name())
+		if _, err := os.Stat(filepath.Join(dir, "portal_test_db.sql")); err != nil {
+			log.Println("Skipping", dir, "(missing portal_test_db.sql)")
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, "nexus_test_db.sql")); err != nil {
+			log.Println("Skipping", dir, "(missing nexus_test_db.sql)")
+			continue
+		}
+		versions = append(versions, e.Name())
+	}
+	sort.Strings(versions)
+
+	return versions, nil
+}
+
+// runUpgradeTest loads an archived release into the test databases, lets the
+// suite run updateDatabase.php against it, then runs the smoke tests
+func runUpgradeTest(w io.Writer, version string, modeVerbose bool) upgradeResult {
+	// Paths are relative to the API-tests directory, where go test runs
+	dir := filepath.Join("database", "archive", version)
+	args := []string{"test", "-count=1", "-run", upgradeSmokeTests}
+	if modeVerbose {
+		args = append(args, "-v")
+	}
+	args = append(args, "-args",
+		"-portal.sql="+filepath.Join(dir, "portal_test_db.sql"),
+		"-nexus.sql="+filepath.Join(dir, "nexus_test_db.sql"))
+
+	var out bytes.Buffer
+	cmd := exec.Command("go", args...)
+	cmd.Dir = "../API-tests/"
+	cmd.Stdout = io.MultiWriter(w, &out)
+	cmd.Stderr = io.MultiWriter(w, &out)
+	err := cmd.Run()
+
+	result := upgradeResult{Version: version, Status: "PASS"}
+	switch {
+	case err == nil:
+	case strings.Contains(out.String(), "Could not update"):
+		result.Status = "SCHEMA UPDATE FAILED"
+	default:
+		result.Status = "FAIL"
+		for _, m := range failedTestPattern.FindAllStringSubmatch(out.String(), -1) {
+			result.FailedTests = append(result.FailedTests, m[1])
+		}
+	}
+
+	return result
+}
+
+// handleRunUpgradeTest runs the smoke tests against every archived release, or a
+// single one when ?version= is set, and reports a result per release
+func handleRunUpgradeTest(w http.ResponseWriter, r *http.Request) {
+	modeVerbose := r.URL.Query().Has("-v")
+	onlyVersion := r.URL.Query().Get("version")
+
+	mxRunningTests.Lock()
+	if !runningTests {
+		runningTests = true
+		printLog(w, "Running upgrade-path tests: LEAF/API-tester")
+
+		versions, err := upgradeVersions()
+		if err != nil {
+			printLog(w, "Could not read "+upgradeArchiveDir+": "+err.Error())
+		}
+
+		var results []upgradeResult
+		for _, version := range versions {
+			if onlyVersion != "" && version != onlyVersion {
+				continue
+			}
+			printLog(w, "\n=== Upgrading from "+version)
+			results = append(results, runUpgradeTest(w, version, modeVerbose))
+		}
+
+		printLog(w, "\nUpgrade-path results:")
+		if len(results) == 0 {
+			printLog(w, "No archived releases found in "+upgradeArchiveDir)
+		}
+		for _, res := range results {
+			msg := fmt.Sprintf("%-24s %s", res.Version, res.Status)
+			if len(res.FailedTests) > 0 {
+				msg += " (" + strings.Join(res.FailedTests, ", ") + ")"
+			}
+			printLog(w, msg)
+		}
+
+		runningTests = false
+		mxRunningTests.Unlock()
+	} else {
+		io.WriteString(w, "Already running tests")
+	}
+}